@@ -1,39 +1,147 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"flow-indexer/internal/adapter"
+	"flow-indexer/internal/config"
+	"flow-indexer/internal/handler"
+	"flow-indexer/internal/rpc"
+	"flow-indexer/internal/service"
+	"flow-indexer/internal/stream"
+	"flow-indexer/pkg/api/middlewares"
+	"flow-indexer/pkg/app"
+	"flow-indexer/pkg/log"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	gormpkg "flow-indexer/pkg/gorm"
 )
 
 func main() {
-	borrow := 1500000.0
-	month := 84
-	// rate := 0.0238 // 2.38%
-	yeild := 0.150 // 15%
-	usdPrice := 31.0
-	repay := 19404.0
+	// load config, the api serves more concurrent queries than the indexer
+	def := config.Default()
+	def.Database.MaxIdleConns = 4
+	def.Database.MaxOpenConns = 8
+	cfg, args, err := config.Load("api", def, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(args) > 0 && args[0] == "config" {
+		err = config.Command(cfg, args[1:], os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
 
-	usdBalance := borrow / usdPrice
-	fmt.Printf("TWD: %v -> USD: %v\n", int(borrow), usdBalance)
-	fmt.Printf("Bitfinex yeild: %v\n", yeild)
-	fmt.Printf("repay monthly: %v\n", repay)
+	// init logger
+	syncFun, err := log.Init(cfg.LogConfig("api.log"))
+	if err != nil {
+		panic(err)
+	}
+	defer syncFun()
+	logger := zap.L()
 
-	totalRepayTWD := 0.0
+	// prepare context
+	ctx := app.GraceCtx(context.Background())
 
-	for i := 1; i <= month; i++ {
-		interest := getMonthlyInterest(usdBalance, yeild)
-		usdBalance += interest
-		repayUSD := getMonthlyRepay(repay, 27.0)
-		usdBalance -= repayUSD
-		totalRepayTWD += repay
-		fmt.Printf("month: %d, interest: %f, repay: %f, usdBalance: %f\n", i, interest, repayUSD, usdBalance)
+	// init db, the schema is owned by the indexer
+	db, err := gormpkg.NewGormPostgresConn(cfg.GormConfig())
+	if err != nil {
+		logger.Error("connect to database error", zap.Error(err))
+		return
 	}
 
-}
+	// prepare service
+	svc := service.NewService(
+		adapter.NewTransactor(db),
+		adapter.NewAccountRepo(db),
+		adapter.NewInscriptionRepo(db),
+		adapter.NewEventRepo(db),
+		adapter.NewCheckpointRepo(db),
+		adapter.NewAnomalyRepo(db),
+		adapter.NewSnapshotRepo(db),
+		adapter.NewNFTRepo(db),
+		adapter.NewTransferRepo(db),
+		adapter.NewChangePublisher(db),
+	)
 
-func getMonthlyInterest(balance, yeild float64) float64 {
-	return balance * yeild / 12
-}
+	// relay the changes committed by the indexer to the streaming clients
+	hub := stream.NewHub()
+	go func() {
+		_ = adapter.ListenChanges(ctx, cfg.Database.ConnString(), logger, hub.Publish)
+	}()
 
-func getMonthlyRepay(repay, usdPrice float64) float64 {
-	return repay / usdPrice
+	// init router
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(gin.Recovery(), middlewares.CtxLogger)
+	handler.NewHandler(svc, hub).Register(router)
+
+	srv := &http.Server{
+		Addr:    cfg.API.HTTPAddr,
+		Handler: router,
+	}
+
+	// init grpc server
+	grpcAddr := cfg.API.GRPCAddr
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		logger.Error("listen grpc error", zap.Error(err))
+		return
+	}
+	grpcSrv := grpc.NewServer()
+	rpc.NewServer(svc, hub).Register(grpcSrv)
+	go func() {
+		logger.Info("start grpc server", zap.String("addr", grpcAddr))
+		if err := grpcSrv.Serve(lis); err != nil {
+			logger.Error("grpc server error", zap.Error(err))
+		}
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-ctx.Done()
+		// end the streams so that they don't hold the shutdown
+		hub.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("shutdown api server error", zap.Error(err))
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcSrv.Stop()
+		}
+	}()
+
+	logger.Info("start api server", zap.String("addr", srv.Addr))
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("api server error", zap.Error(err))
+		return
+	}
+	<-closed
 }
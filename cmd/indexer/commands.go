@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"flow-indexer/internal/config"
+	"flow-indexer/internal/service"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	flowUtils "flow-indexer/pkg/flow"
+
+	"github.com/onflow/flow-go-sdk/client"
+	"go.uber.org/zap"
+)
+
+var (
+	// errUsage reports a usage error that was already printed.
+	errUsage = errors.New("usage error")
+	// errMismatch reports that verify found differences.
+	errMismatch = errors.New("balances differ from the events")
+)
+
+// command is a subcommand of the indexer binary. Commands parse their own
+// flags from args, which follow the command name.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// set in init as the commands look themselves up for their usage
+	commands = []command{
+		{"run", "", "backfill the configured range, then follow the chain head if scanner.follow is set (default)", runIndexer},
+		{"backfill", "[-from height] [-to height]", "index a block range, resuming from its checkpoints", backfill},
+		{"follow", "[-from height]", "index the chain head as blocks are sealed", follow},
+		{"rebuild-balances", "[-inscription name]", "recompute balances, anomalies and snapshots from the stored events", rebuildBalances},
+		{"verify", "[-inscription name]", "compare the stored balances with the events, exits 3 on differences", verify},
+		{"status", "[-offline]", "print the checkpoints, the indexed height and the lag behind the chain", status},
+		{"export", "holders -inscription name [-height height] [-format csv|json] [-o file]", "export the holders of an inscription", export},
+		{"migrate", "up|down|status [-dry-run] [-steps n]", "apply, revert or list the schema migrations", migrate},
+		{"reset", "-to-height height", "delete everything indexed above a height and rebuild the state", reset},
+		{"anomalies", "[-inscription name]", "list the events that made a balance negative", listAnomalies},
+		{"supply", "-inscription name [-height height]", "print the supply of an inscription", printSupply},
+		{"config", "print [-format yaml|toml]", "print the configuration with its secrets redacted", printConfig},
+	}
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage() {
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "usage: indexer [config flags] <command> [command flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "exit codes: 0 success, 1 failure, 2 usage error, 3 verify found differences, 130 interrupted")
+	w.Flush()
+}
+
+// newFlagSet returns the flag set of the named command.
+func newFlagSet(name string) *flag.FlagSet {
+	c, _ := lookupCommand(name)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: indexer %s %s\n\n%s\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args into fs and rejects positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	if err != nil {
+		// already printed by fs
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "unexpected argument %q", fs.Arg(0))
+	}
+	return nil
+}
+
+// usageError prints a usage error of the command of fs.
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(fs.Output(), format+"\n", args...)
+	fs.Usage()
+	return errUsage
+}
+
+// runIndexer backfills the configured block range and follows the chain
+// head afterwards if configured to.
+func runIndexer(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("run")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	svc, flowClient, err := e.startIndexing(ctx)
+	if err != nil {
+		return err
+	}
+
+	sc := e.cfg.Scanner
+	err = scanRange(ctx, e, svc, flowClient, sc.StartBlock, sc.EndBlock)
+	if err != nil || !sc.Follow {
+		return err
+	}
+	return followHead(ctx, e, svc, flowClient, sc.EndBlock+1)
+}
+
+// backfill indexes a block range, the configured one by default.
+func backfill(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("backfill")
+	from := fs.Uint64("from", e.cfg.Scanner.StartBlock, "first `height` of the range")
+	to := fs.Uint64("to", e.cfg.Scanner.EndBlock, "last `height` of the range")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *from > *to {
+		return usageError(fs, "-from %d is after -to %d", *from, *to)
+	}
+
+	svc, flowClient, err := e.startIndexing(ctx)
+	if err != nil {
+		return err
+	}
+	return scanRange(ctx, e, svc, flowClient, *from, *to)
+}
+
+// follow indexes the chain head, after the configured range by default.
+func follow(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("follow")
+	from := fs.Uint64("from", e.cfg.Scanner.EndBlock+1, "first `height` to follow from, its checkpoint is kept under this height")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	svc, flowClient, err := e.startIndexing(ctx)
+	if err != nil {
+		return err
+	}
+	return followHead(ctx, e, svc, flowClient, *from)
+}
+
+// scanRange scans the heights of [startBlock, endBlock] no checkpoint covers
+// yet. Deposit and Withdraw events are applied together in chain order.
+func scanRange(
+	ctx context.Context, e *env, svc service.Service, flowClient *client.Client, startBlock, endBlock uint64,
+) error {
+	sc := e.cfg.Scanner
+	e.logger.Info("start scan", zap.Uint64("startBlock", startBlock), zap.Uint64("endBlock", endBlock))
+	err := flowUtils.ScanRanges(
+		ctx,
+		startBlock,
+		endBlock,
+		sc.MaxBlockQuery,
+		sc.Threads,
+		flowClient,
+		e.logger,
+		svc,
+		sc.EventTypes,
+	)
+	if err != nil {
+		return fmt.Errorf("backfill stopped: %w", err)
+	}
+	e.logger.Info("backfill done", zap.Uint64("endBlock", endBlock))
+	return nil
+}
+
+// followHead indexes sealed blocks from startBlock on until it fails.
+func followHead(ctx context.Context, e *env, svc service.Service, flowClient *client.Client, startBlock uint64) error {
+	sc := e.cfg.Scanner
+	err := flowUtils.FollowEvents(
+		ctx,
+		startBlock,
+		sc.MaxBlockQuery,
+		sc.FinalityLag,
+		sc.PollInterval,
+		flowClient,
+		e.logger,
+		svc,
+		sc.EventTypes,
+	)
+	if err != nil {
+		return fmt.Errorf("follow stopped: %w", err)
+	}
+	return nil
+}
+
+// rebuildBalances recomputes balances and snapshots from the stored events.
+func rebuildBalances(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("rebuild-balances")
+	insName := fs.String("inscription", "", "only rebuild the balances of this inscription")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	svc, err := e.service()
+	if err != nil {
+		return err
+	}
+	return svc.RebuildBalances(ctx, *insName)
+}
+
+// verify prints the balances that differ from the stored events.
+func verify(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("verify")
+	insName := fs.String("inscription", "", "only verify the balances of this inscription")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	svc, err := e.service()
+	if err != nil {
+		return err
+	}
+	mismatches, err := svc.VerifyBalances(ctx, *insName)
+	if err != nil {
+		return err
+	}
+	if len(mismatches) == 0 {
+		fmt.Println("balances match the events")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSCRIPTION\tACCOUNT\tSTORED\tEXPECTED")
+	for _, m := range mismatches {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", m.Inscription, m.Account, m.Stored, m.Expected)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d balances differ from the events, run rebuild-balances to fix them\n", len(mismatches))
+	return errMismatch
+}
+
+// status prints the checkpoints and how far the index is behind the sealed
+// chain head.
+func status(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("status")
+	offline := fs.Bool("offline", false, "do not query the access node for the chain head")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	svc, err := e.service()
+	if err != nil {
+		return err
+	}
+	checkpoints, err := svc.ListCheckpoints(ctx)
+	if err != nil {
+		return err
+	}
+	indexed, err := svc.IndexedHeight(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "indexed height\t%d\n", indexed)
+	if !*offline {
+		flowClient, err := e.flowClient()
+		if err != nil {
+			return err
+		}
+		header, err := flowClient.GetLatestBlockHeader(ctx, true)
+		if err != nil {
+			return fmt.Errorf("GetLatestBlockHeader: %w", err)
+		}
+		lag := uint64(0)
+		if header.Height > indexed {
+			lag = header.Height - indexed
+		}
+		fmt.Fprintf(w, "sealed height\t%d\n", header.Height)
+		fmt.Fprintf(w, "lag\t%d blocks\n", lag)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "START\tEND\tHEIGHT\tSTATE\tEVENT_TYPES")
+	for _, cp := range checkpoints {
+		end, state := strconv.FormatUint(cp.EndBlock, 10), "scanning"
+		switch {
+		case cp.EndBlock == 0:
+			end, state = "-", "following"
+		case cp.Height >= cp.EndBlock:
+			state = "done"
+		case cp.Height < cp.StartBlock:
+			state = "pending"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", cp.StartBlock, end, cp.Height, state, cp.EventType)
+	}
+	return w.Flush()
+}
+
+// export writes data of the index to a file or stdout.
+func export(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 || args[0] != "holders" {
+		fs := newFlagSet("export")
+		return usageError(fs, "unknown export, only holders can be exported")
+	}
+
+	fs := newFlagSet("export")
+	insName := fs.String("inscription", "", "`name` of the inscription, required")
+	height := fs.Uint64("height", 0, "export the holders as of this `height`, the indexed height by default")
+	format := fs.String("format", "csv", "output `format`, csv or json")
+	output := fs.String("o", "", "output `file`, stdout by default")
+	err := parseFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if *insName == "" {
+		return usageError(fs, "-inscription is required")
+	}
+	if *format != "csv" && *format != "json" {
+		return usageError(fs, "unknown format %q", *format)
+	}
+
+	svc, err := e.service()
+	if err != nil {
+		return err
+	}
+	if *height == 0 {
+		*height, err = svc.IndexedHeight(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	holders, err := svc.HoldersAt(ctx, *insName, *height)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	type holder struct {
+		Rank    int    `json:"rank"`
+		Account string `json:"account"`
+		Amount  int64  `json:"amount"`
+	}
+	rows := make([]holder, len(holders))
+	for i, h := range holders {
+		rows[i] = holder{Rank: i + 1, Account: h.Account, Amount: h.Amount}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			Inscription string   `json:"inscription"`
+			Height      uint64   `json:"height"`
+			Holders     []holder `json:"holders"`
+		}{*insName, *height, rows})
+	} else {
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"rank", "account", "amount"})
+		for _, r := range rows {
+			_ = cw.Write([]string{strconv.Itoa(r.Rank), r.Account, strconv.FormatInt(r.Amount, 10)})
+		}
+		cw.Flush()
+		err = cw.Error()
+	}
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		e.logger.Info("exported holders", zap.String("inscription", *insName), zap.Uint64("height", *height),
+			zap.Int("holders", len(rows)), zap.String("file", *output))
+	}
+	return nil
+}
+
+// migrate applies or reverts the schema migrations, or lists them.
+func migrate(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("migrate")
+	dryRun := fs.Bool("dry-run", false, "print the statements instead of running them")
+	steps := fs.Int("steps", 1, "number of migrations to revert with down")
+	action := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if action != "up" && action != "down" && action != "status" {
+		return usageError(fs, "unknown action %q, up, down or status", action)
+	}
+	if *steps < 1 {
+		return usageError(fs, "-steps must be positive")
+	}
+
+	var out io.Writer
+	if *dryRun {
+		out = os.Stdout
+	}
+	m, err := e.migrator(out)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx, *steps)
+	default:
+		states, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED_AT")
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+}
+
+// reset rolls the index back to a height.
+func reset(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("reset")
+	height := fs.Uint64("to-height", 0, "keep what is indexed up to this `height`, required")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == "to-height"
+	})
+	if !set {
+		return usageError(fs, "-to-height is required")
+	}
+
+	svc, err := e.service()
+	if err != nil {
+		return err
+	}
+	err = svc.ResetToHeight(ctx, *height)
+	if err != nil {
+		return err
+	}
+	e.logger.Info("reset", zap.Uint64("height", *height))
+	return nil
+}
+
+// listAnomalies prints the recorded negative balance events.
+func listAnomalies(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("anomalies")
+	insName := fs.String("inscription", "", "only list the anomalies of this inscription")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	svc, err := e.service()
+	if err != nil {
+		return err
+	}
+	anomalies, err := svc.ListAnomalies(ctx, *insName)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BLOCK\tTX\tTX_INDEX\tEVENT_INDEX\tEVENT\tINSCRIPTION\tACCOUNT\tNFT_ID\tAMOUNT")
+	for _, a := range anomalies {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\t%s\t%d\t%d\n",
+			a.Block, a.TransactionID, a.TransactionIndex, a.EventIndex, a.Event, a.Inscription, a.Account, a.NFTID, a.Amount)
+	}
+	return w.Flush()
+}
+
+// printSupply prints the supply of an inscription as of a height, the
+// indexed height by default.
+func printSupply(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("supply")
+	insName := fs.String("inscription", "", "`name` of the inscription, required")
+	height := fs.Uint64("height", 0, "supply as of this `height`, the indexed height by default")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *insName == "" {
+		return usageError(fs, "-inscription is required")
+	}
+
+	svc, err := e.service()
+	if err != nil {
+		return err
+	}
+	if *height == 0 {
+		*height, err = svc.IndexedHeight(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	supply, err := svc.SupplyAt(ctx, *insName, *height)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSCRIPTION\tHEIGHT\tMINTED\tBURNED\tTOTAL\tESCROWED\tCIRCULATING\tHOLDERS")
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+		supply.Inscription, supply.Height, supply.Minted, supply.Burned, supply.Total, supply.Escrowed, supply.Circulating, supply.Holders)
+	return w.Flush()
+}
+
+// printConfig prints the configuration.
+func printConfig(ctx context.Context, e *env, args []string) error {
+	err := config.Command(e.cfg, args, os.Stdout)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, err)
+		return errUsage
+	}
+	return err
+}
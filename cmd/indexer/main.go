@@ -1,131 +1,222 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"flow-indexer/internal/adapter"
-	"flow-indexer/internal/domain/account"
-	flowEvent "flow-indexer/internal/domain/event"
-	"flow-indexer/internal/domain/inscription"
+	"flow-indexer/internal/config"
+	"flow-indexer/internal/migration"
 	"flow-indexer/internal/service"
+	"flow-indexer/pkg/app"
 	"flow-indexer/pkg/log"
 	"fmt"
-	"sync"
+	"io"
+	"os"
 	"time"
 
-	flowUtils "flow-indexer/pkg/flow"
-
 	"github.com/onflow/flow-go-sdk/client"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"gorm.io/gorm"
 
 	gormpkg "flow-indexer/pkg/gorm"
 )
 
+// Exit codes of the indexer binary.
+const (
+	exitOK = 0
+	// exitError reports a failed command.
+	exitError = 1
+	// exitUsage reports invalid flags, arguments or configuration.
+	exitUsage = 2
+	// exitMismatch reports that verify found balances differing from the
+	// events.
+	exitMismatch = 3
+	// exitInterrupted reports a command stopped by SIGINT or SIGTERM before
+	// it was done, following the shell convention for SIGINT. A second
+	// signal exits with it without waiting for the drain, see app.GraceCtx.
+	exitInterrupted = 130
+)
+
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command given by args and returns the exit code.
+func run(args []string) int {
+	// load config
+	cfg, args, err := config.Load("indexer", config.Default(), args)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage()
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	name := "run"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
+		return exitOK
+	}
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		printUsage()
+		return exitUsage
+	}
+
 	// init logger
-	syncFun, err := log.Init(log.Config{
-		Name:   "indexer.log",
-		Level:  zapcore.InfoLevel,
-		Stdout: true,
-		// File:   "log/indexer/indexer.log",
-		File: "",
-	})
+	syncFun, err := log.Init(cfg.LogConfig("indexer.log"))
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
 	}
 	defer syncFun()
-	logger := zap.L()
 
-	// prepare context
-	// ctx := app.GraceCtx(context.Background())
+	// prepare context, cancelled on SIGINT and SIGTERM
+	ctx := app.GraceCtx(context.Background())
+
+	e := &env{cfg: cfg, logger: zap.L()}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.run(ctx, e, args)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// no new batch is scheduled from now on, wait for the one being
+		// committed
+		timer := time.NewTimer(cfg.Scanner.ShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case err = <-done:
+		case <-timer.C:
+			e.logger.Error("shutdown timed out", zap.String("command", name), zap.Duration("timeout", cfg.Scanner.ShutdownTimeout))
+			return exitError
+		}
+	}
 
-	// init db
-	time.Sleep(1 * time.Second)
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		"abc", "abc", "db", "5432", "postgres")
-	logger.Info("dsn", zap.String("dsn", dsn))
-
-	db, err := gormpkg.NewGormPostgresConn(
-		gormpkg.Config{
-			DSN:             dsn,
-			MaxIdleConns:    2,
-			MaxOpenConns:    2,
-			ConnMaxLifetime: 10 * time.Minute,
-			SingularTable:   true,
-		},
-	)
-	if err != nil {
-		logger.Error("connect to database error", zap.Error(err))
-		return
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case ctx.Err() != nil && errors.Is(err, context.Canceled):
+		e.logger.Info("stopped", zap.String("command", name))
+		return exitInterrupted
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, errMismatch):
+		return exitMismatch
+	default:
+		e.logger.Error("command error", zap.String("command", name), zap.Error(err))
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitError
 	}
+}
 
-	// create extension
-	db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
+// env holds what the commands share. The database and the Flow client are
+// only opened by the commands that use them.
+type env struct {
+	cfg    config.Config
+	logger *zap.Logger
 
-	// migrate db
-	err = db.AutoMigrate(
-		&account.Account{},
-		&inscription.Balance{},
-		&flowEvent.FlowEvent{},
-	)
+	db   *gorm.DB
+	svc  service.Service
+	flow *client.Client
+}
+
+// openDB connects to the database.
+func (e *env) openDB() (*gorm.DB, error) {
+	if e.db != nil {
+		return e.db, nil
+	}
+	db, err := gormpkg.NewGormPostgresConn(e.cfg.GormConfig())
 	if err != nil {
-		logger.Error("migrate db error", zap.Error(err))
-		return
+		return nil, fmt.Errorf("connect to database: %w", err)
 	}
+	e.db = db
+	return db, nil
+}
 
-	// prepare service
-	accountRepo := adapter.NewAccountRepo(db)
-	inscriptionRepo := adapter.NewInscriptionRepo(db)
-	eventRepo := adapter.NewEventRepo(db)
+// migrator returns the schema migrator, printing the statements to dryRun
+// instead of running them if it is not nil.
+func (e *env) migrator(dryRun io.Writer) (*migration.Migrator, error) {
+	db, err := e.openDB()
+	if err != nil {
+		return nil, err
+	}
+	return migration.New(db, e.logger, dryRun)
+}
 
-	svc := service.NewService(
-		accountRepo,
-		inscriptionRepo,
-		eventRepo,
+// service returns the service on top of the database.
+func (e *env) service() (service.Service, error) {
+	if e.svc != nil {
+		return e.svc, nil
+	}
+	db, err := e.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	e.svc = service.NewService(
+		adapter.NewTransactor(db),
+		adapter.NewAccountRepo(db),
+		adapter.NewInscriptionRepo(db),
+		adapter.NewEventRepo(db),
+		adapter.NewCheckpointRepo(db),
+		adapter.NewAnomalyRepo(db),
+		adapter.NewSnapshotRepo(db),
+		adapter.NewNFTRepo(db),
+		adapter.NewTransferRepo(db),
+		adapter.NewChangePublisher(db),
 	)
+	return e.svc, nil
+}
 
-	// init flow client
-	maxMsgSize := 50 * 1024 * 1024 // 50MB
+// flowClient connects to the Flow access node.
+func (e *env) flowClient() (*client.Client, error) {
+	if e.flow != nil {
+		return e.flow, nil
+	}
 	flowClient, err := client.New(
-		"access.mainnet.nodes.onflow.org:9000",
+		e.cfg.Flow.AccessNode,
 		grpc.WithInsecure(),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize)),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(e.cfg.Flow.MaxMsgSize)),
 	)
+	if err != nil {
+		return nil, fmt.Errorf("connect to access node: %w", err)
+	}
+	e.flow = flowClient
+	return flowClient, nil
+}
+
+// startIndexing prepares the database and the Flow client for the commands
+// that index events.
+func (e *env) startIndexing(ctx context.Context) (service.Service, *client.Client, error) {
+	// give the database time to come up along with the indexer
+	time.Sleep(1 * time.Second)
 
+	m, err := e.migrator(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = m.Up(ctx)
 	if err != nil {
-		panic(err)
-	}
-
-	// scan
-	thread := 15
-	maxBlockQuery := uint64(250) - 1
-	startBlock := uint64(68277132) // freeflow deployment block
-	endBlock := uint64(69434891)   // last scaned block
-
-	// startBlock := uint64(69240422) + 1 // last scaned block
-	// latestBlock, err := flowClient.GetLatestBlock(context.Background(), true)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	// endBlock := latestBlock.Height
-
-	logger.Info("start scan", zap.Uint64("startBlock", startBlock), zap.Uint64("endBlock", endBlock))
-	blockRanges := flowUtils.GetBlockRanges(startBlock, endBlock, uint64(thread))
-	var wg sync.WaitGroup
-	for _, blockRange := range blockRanges {
-		wg.Add(1)
-		logger.Info("scan range", zap.Uint64("startBlock", blockRange.StartBlock), zap.Uint64("endBlock", blockRange.EndBlock))
-		flowUtils.ScanRangeEvents(
-			blockRange.StartBlock,
-			blockRange.EndBlock,
-			maxBlockQuery,
-			flowClient,
-			logger,
-			svc,
-			flowUtils.FreeflowWithdrawEventType, // FreeflowDepositEventType
-			&wg,
-		)
-	}
-
-	wg.Wait()
+		return nil, nil, fmt.Errorf("migrate db: %w", err)
+	}
+	svc, err := e.service()
+	if err != nil {
+		return nil, nil, err
+	}
+	flowClient, err := e.flowClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	return svc, flowClient, nil
 }
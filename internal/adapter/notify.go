@@ -0,0 +1,88 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"flow-indexer/internal/domain/event"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// changeChannel is the Postgres channel changes are notified on.
+const changeChannel = "flow_inscription_change"
+
+type changePublisher struct {
+	db *gorm.DB
+}
+
+// NewChangePublisher returns a publisher sending every change as a Postgres
+// notification, which is delivered when the surrounding transaction commits.
+func NewChangePublisher(db *gorm.DB) event.Publisher {
+	return &changePublisher{db: db}
+}
+
+func (p *changePublisher) Publish(ctx context.Context, changes []event.Change) error {
+	db := conn(ctx, p.db)
+	for _, change := range changes {
+		payload, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		err = db.Exec("SELECT pg_notify(?, ?)", changeChannel, string(payload)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListenChanges calls fn for every change published on dsn until ctx is done,
+// reconnecting after connection errors. Changes notified while disconnected
+// are lost, consumers resume from the event log.
+func ListenChanges(ctx context.Context, dsn string, logger *zap.Logger, fn func(change event.Change)) error {
+	for {
+		err := listenChanges(ctx, dsn, logger, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.Error("listen changes", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func listenChanges(ctx context.Context, dsn string, logger *zap.Logger, fn func(change event.Change)) error {
+	c, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer c.Close(context.Background())
+
+	_, err = c.Exec(ctx, "LISTEN "+changeChannel)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	for {
+		n, err := c.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+
+		var change event.Change
+		err = json.Unmarshal([]byte(n.Payload), &change)
+		if err != nil {
+			logger.Error("decode change", zap.Error(err))
+			continue
+		}
+		fn(change)
+	}
+}
@@ -18,7 +18,7 @@ func NewAccountRepo(db *gorm.DB) account.Repository {
 func (r *accountRepo) FirstOrCreate(ctx context.Context, address string) (*account.Account, error) {
 	var account account.Account
 	account.Address = address
-	err := r.db.WithContext(ctx).Where("address = ?", address).FirstOrCreate(&account).Error
+	err := conn(ctx, r.db).Where("address = ?", address).FirstOrCreate(&account).Error
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +27,7 @@ func (r *accountRepo) FirstOrCreate(ctx context.Context, address string) (*accou
 
 func (r *accountRepo) GetByAddress(ctx context.Context, address string) (*account.Account, error) {
 	var account account.Account
-	err := r.db.WithContext(ctx).Where("address = ?", address).First(&account).Error
+	err := conn(ctx, r.db).Where("address = ?", address).First(&account).Error
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,41 @@
+package adapter
+
+import (
+	"context"
+	"flow-indexer/internal/domain/anomaly"
+
+	"gorm.io/gorm"
+)
+
+type anomalyRepo struct {
+	db *gorm.DB
+}
+
+func NewAnomalyRepo(db *gorm.DB) anomaly.Repository {
+	return &anomalyRepo{db: db}
+}
+
+func (r *anomalyRepo) Create(ctx context.Context, anomaly *anomaly.Anomaly) error {
+	return conn(ctx, r.db).Create(anomaly).Error
+}
+
+func (r *anomalyRepo) List(ctx context.Context, insName string) ([]anomaly.Anomaly, error) {
+	var anomalies []anomaly.Anomaly
+	db := conn(ctx, r.db)
+	if insName != "" {
+		db = db.Where("inscription = ?", insName)
+	}
+	err := db.Order("block, transaction_index, event_index").Find(&anomalies).Error
+	if err != nil {
+		return nil, err
+	}
+	return anomalies, nil
+}
+
+func (r *anomalyRepo) Delete(ctx context.Context, insName string) error {
+	db := conn(ctx, r.db)
+	if insName == "" {
+		return db.Exec("TRUNCATE TABLE " + anomaly.Anomaly{}.TableName()).Error
+	}
+	return db.Where("inscription = ?", insName).Delete(&anomaly.Anomaly{}).Error
+}
@@ -0,0 +1,44 @@
+package adapter
+
+import (
+	"context"
+	"flow-indexer/internal/domain/checkpoint"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type checkpointRepo struct {
+	db *gorm.DB
+}
+
+func NewCheckpointRepo(db *gorm.DB) checkpoint.Repository {
+	return &checkpointRepo{db: db}
+}
+
+func (r *checkpointRepo) Save(ctx context.Context, cp *checkpoint.Checkpoint) error {
+	return conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "event_type"}, {Name: "start_block"}, {Name: "end_block"}},
+		DoUpdates: clause.AssignmentColumns([]string{"height", "updated_at"}),
+	}).Create(cp).Error
+}
+
+func (r *checkpointRepo) List(ctx context.Context) ([]checkpoint.Checkpoint, error) {
+	var checkpoints []checkpoint.Checkpoint
+	err := conn(ctx, r.db).Order("event_type, start_block, end_block").Find(&checkpoints).Error
+	if err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+func (r *checkpointRepo) Rewind(ctx context.Context, height uint64) error {
+	db := conn(ctx, r.db)
+	err := db.Where("start_block > ?", height).Delete(&checkpoint.Checkpoint{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&checkpoint.Checkpoint{}).
+		Where("height > ?", height).
+		Updates(map[string]interface{}{"height": height, "updated_at": gorm.Expr("now()")}).Error
+}
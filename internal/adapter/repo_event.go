@@ -3,8 +3,11 @@ package adapter
 import (
 	"context"
 	"flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/transfer"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type eventRepo struct {
@@ -15,6 +18,164 @@ func NewEventRepo(db *gorm.DB) event.Repository {
 	return &eventRepo{db: db}
 }
 
-func (r *eventRepo) Create(ctx context.Context, event *event.FlowEvent) error {
-	return r.db.WithContext(ctx).Create(&event).Error
+func (r *eventRepo) Create(ctx context.Context, event *event.FlowEvent) (bool, error) {
+	result := conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *eventRepo) Iterate(ctx context.Context, insName string, fn func(event *event.FlowEvent) error) error {
+	db := conn(ctx, r.db).Model(&event.FlowEvent{})
+	if insName != "" {
+		db = db.Where("inscription = ?", insName)
+	}
+	rows, err := db.Order("block, transaction_index, event_index").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fe event.FlowEvent
+		err = db.ScanRows(rows, &fe)
+		if err != nil {
+			return err
+		}
+		err = fn(&fe)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *eventRepo) ListByAccount(ctx context.Context, address string, limit, offset int) ([]event.FlowEvent, error) {
+	var events []event.FlowEvent
+	err := conn(ctx, r.db).
+		Where("account = ?", address).
+		Order("block DESC, transaction_index DESC, event_index DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// whereEventType filters the events of table alias by eventType, which is
+// either a full event type or deposit or withdraw.
+func whereEventType(db *gorm.DB, alias, eventType string) *gorm.DB {
+	deposit := alias + ".event LIKE '%" + event.DepositSuffix + "'"
+	switch strings.ToLower(eventType) {
+	case "":
+		return db
+	case "deposit":
+		return db.Where(deposit)
+	case "withdraw":
+		return db.Where("NOT " + deposit)
+	default:
+		return db.Where(alias+".event = ?", eventType)
+	}
+}
+
+func (r *eventRepo) ListActivity(ctx context.Context, address string, filter event.ActivityFilter) ([]event.Activity, error) {
+	deposit := "e.event LIKE '%" + event.DepositSuffix + "'"
+	db := conn(ctx, r.db).Table(event.FlowEvent{}.TableName()+" e").
+		Select("e.*, COALESCE(t.kind, '') AS transfer_kind, "+
+			"COALESCE(CASE WHEN "+deposit+" THEN t.from_account ELSE t.to_account END, '') AS counterparty").
+		Joins("LEFT JOIN "+transfer.Transfer{}.TableName()+" t ON "+
+			"t.transaction_id = e.transaction_id AND t.inscription = e.inscription AND t.nft_id = e.nft_id AND "+
+			"CASE WHEN "+deposit+" THEN t.to_account ELSE t.from_account END = e.account").
+		Where("e.account = ?", address)
+
+	if filter.Inscription != "" {
+		db = db.Where("e.inscription = ?", filter.Inscription)
+	}
+	db = whereEventType(db, "e", filter.Event)
+	if filter.FromHeight > 0 {
+		db = db.Where("e.block >= ?", filter.FromHeight)
+	}
+	if filter.ToHeight > 0 {
+		db = db.Where("e.block <= ?", filter.ToHeight)
+	}
+	if filter.After != nil {
+		db = db.Where("(e.block, e.transaction_index, e.event_index) > (?, ?, ?)",
+			filter.After.Block, filter.After.TransactionIndex, filter.After.EventIndex)
+	}
+
+	var activities []event.Activity
+	err := db.Order("e.block, e.transaction_index, e.event_index").Limit(filter.Limit).Scan(&activities).Error
+	if err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+func (r *eventRepo) ListByAccounts(ctx context.Context, addresses []string, filter event.ActivityFilter) ([]event.FlowEvent, error) {
+	db := conn(ctx, r.db).Table(event.FlowEvent{}.TableName()+" e").
+		Select("e.*, ROW_NUMBER() OVER (PARTITION BY e.account ORDER BY e.block, e.transaction_index, e.event_index) AS n").
+		Where("e.account IN ?", addresses)
+
+	if filter.Inscription != "" {
+		db = db.Where("e.inscription = ?", filter.Inscription)
+	}
+	db = whereEventType(db, "e", filter.Event)
+	if filter.FromHeight > 0 {
+		db = db.Where("e.block >= ?", filter.FromHeight)
+	}
+	if filter.ToHeight > 0 {
+		db = db.Where("e.block <= ?", filter.ToHeight)
+	}
+	if filter.After != nil {
+		db = db.Where("(e.block, e.transaction_index, e.event_index) > (?, ?, ?)",
+			filter.After.Block, filter.After.TransactionIndex, filter.After.EventIndex)
+	}
+
+	var events []event.FlowEvent
+	err := conn(ctx, r.db).Table("(?) ranked", db).
+		Where("n <= ?", filter.Limit).
+		Order("account, block, transaction_index, event_index").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *eventRepo) ListByNFTID(ctx context.Context, insName string, nftID uint64) ([]event.FlowEvent, error) {
+	var events []event.FlowEvent
+	err := conn(ctx, r.db).
+		Where("inscription = ? AND nft_id = ?", insName, nftID).
+		Order("block, transaction_index, event_index").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *eventRepo) ListChanges(ctx context.Context, filter event.ChangeFilter, after event.Position, limit int) ([]event.FlowEvent, error) {
+	db := conn(ctx, r.db).Table(event.FlowEvent{}.TableName()+" e").
+		Where("(e.block, e.transaction_index, e.event_index) > (?, ?, ?)", after.Block, after.TransactionIndex, after.EventIndex)
+	if filter.Account != "" {
+		db = db.Where("e.account = ?", filter.Account)
+	}
+	if filter.Inscription != "" {
+		db = db.Where("e.inscription = ?", filter.Inscription)
+	}
+	db = whereEventType(db, "e", filter.Event)
+
+	var events []event.FlowEvent
+	err := db.Order("e.block, e.transaction_index, e.event_index").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *eventRepo) DeleteAbove(ctx context.Context, height uint64) error {
+	return conn(ctx, r.db).Where("block > ?", height).Delete(&event.FlowEvent{}).Error
 }
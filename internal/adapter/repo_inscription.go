@@ -15,17 +15,85 @@ func NewInscriptionRepo(db *gorm.DB) inscription.Repository {
 	return &inscriptionRepo{db: db}
 }
 
-func (r *inscriptionRepo) Update(ctx context.Context, balance *inscription.Balance) error {
-	return r.db.WithContext(ctx).Updates(balance).Error
+func (r *inscriptionRepo) AddAmount(ctx context.Context, insName, address string, delta int64, block uint64) (int64, error) {
+	var amount int64
+	table := inscription.Balance{}.TableName()
+	err := conn(ctx, r.db).Raw(
+		"INSERT INTO "+table+" (account, inscription, amount, first_seen_height, created_at, updated_at) "+
+			"VALUES (?, ?, ?, ?, now(), now()) "+
+			"ON CONFLICT (account, inscription) DO UPDATE SET amount = "+table+".amount + EXCLUDED.amount, "+
+			"first_seen_height = LEAST(NULLIF("+table+".first_seen_height, 0), EXCLUDED.first_seen_height), "+
+			"updated_at = EXCLUDED.updated_at "+
+			"RETURNING amount",
+		address, insName, delta, block,
+	).Scan(&amount).Error
+	if err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+func (r *inscriptionRepo) Replace(ctx context.Context, insName string, balances []inscription.Balance) error {
+	db := conn(ctx, r.db)
+	var err error
+	if insName == "" {
+		err = db.Exec("TRUNCATE TABLE " + inscription.Balance{}.TableName()).Error
+	} else {
+		err = db.Where("inscription = ?", insName).Delete(&inscription.Balance{}).Error
+	}
+	if err != nil {
+		return err
+	}
+	if len(balances) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(balances, 1000).Error
+}
+
+func (r *inscriptionRepo) ListByAccount(ctx context.Context, address string) ([]inscription.Balance, error) {
+	var balances []inscription.Balance
+	err := conn(ctx, r.db).Where("account = ? AND amount <> 0", address).Order("inscription").Find(&balances).Error
+	if err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+func (r *inscriptionRepo) List(ctx context.Context, insName string) ([]inscription.Balance, error) {
+	var balances []inscription.Balance
+	db := conn(ctx, r.db)
+	if insName != "" {
+		db = db.Where("inscription = ?", insName)
+	}
+	err := db.Order("inscription, account").Find(&balances).Error
+	if err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+func (r *inscriptionRepo) ListByAccounts(ctx context.Context, addresses []string) ([]inscription.Balance, error) {
+	var balances []inscription.Balance
+	err := conn(ctx, r.db).
+		Where("account IN ? AND amount <> 0", addresses).
+		Order("account, inscription").
+		Find(&balances).Error
+	if err != nil {
+		return nil, err
+	}
+	return balances, nil
 }
 
-func (r *inscriptionRepo) GetorCreateByInscriptionAndAddress(ctx context.Context, insName, address string) (*inscription.Balance, error) {
-	var balance inscription.Balance
-	balance.Account = address
-	balance.Inscription = insName
-	err := r.db.WithContext(ctx).Where("inscription = ? AND account = ?", insName, address).FirstOrCreate(&balance).Error
+func (r *inscriptionRepo) ListHolders(ctx context.Context, insName string, limit, offset int) ([]inscription.Balance, error) {
+	var balances []inscription.Balance
+	err := conn(ctx, r.db).
+		Where("inscription = ? AND account <> '' AND amount > 0", insName).
+		Order("amount DESC, account").
+		Limit(limit).
+		Offset(offset).
+		Find(&balances).Error
 	if err != nil {
 		return nil, err
 	}
-	return &balance, nil
+	return balances, nil
 }
@@ -0,0 +1,84 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"flow-indexer/internal/domain"
+	"flow-indexer/internal/domain/nft"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type nftRepo struct {
+	db *gorm.DB
+}
+
+func NewNFTRepo(db *gorm.DB) nft.Repository {
+	return &nftRepo{db: db}
+}
+
+func (r *nftRepo) Save(ctx context.Context, ownership *nft.Ownership) error {
+	return conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "inscription"}, {Name: "nft_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"owner", "acquired_height", "last_transfer_tx", "updated_at"}),
+	}).Create(ownership).Error
+}
+
+func (r *nftRepo) GetByNFTID(ctx context.Context, insName string, nftID uint64) (*nft.Ownership, error) {
+	var ownership nft.Ownership
+	err := conn(ctx, r.db).Where("inscription = ? AND nft_id = ?", insName, nftID).First(&ownership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ownership, nil
+}
+
+func (r *nftRepo) ListByOwner(ctx context.Context, insName, owner string) ([]nft.Ownership, error) {
+	var ownerships []nft.Ownership
+	err := conn(ctx, r.db).Where("inscription = ? AND owner = ?", insName, owner).Order("nft_id").Find(&ownerships).Error
+	if err != nil {
+		return nil, err
+	}
+	return ownerships, nil
+}
+
+func (r *nftRepo) ListByNFTIDs(ctx context.Context, insName string, nftIDs []uint64) ([]nft.Ownership, error) {
+	var ownerships []nft.Ownership
+	err := conn(ctx, r.db).Where("inscription = ? AND nft_id IN ?", insName, nftIDs).Order("nft_id").Find(&ownerships).Error
+	if err != nil {
+		return nil, err
+	}
+	return ownerships, nil
+}
+
+func (r *nftRepo) ListByOwners(ctx context.Context, insName string, owners []string, limit int) ([]nft.Ownership, error) {
+	db := conn(ctx, r.db).Model(&nft.Ownership{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY owner ORDER BY nft_id) AS n").
+		Where("inscription = ? AND owner IN ?", insName, owners)
+
+	var ownerships []nft.Ownership
+	err := conn(ctx, r.db).Table("(?) ranked", db).
+		Where("n <= ?", limit).
+		Order("owner, nft_id").
+		Find(&ownerships).Error
+	if err != nil {
+		return nil, err
+	}
+	return ownerships, nil
+}
+
+func (r *nftRepo) Replace(ctx context.Context, ownerships []nft.Ownership) error {
+	db := conn(ctx, r.db)
+	err := db.Exec("TRUNCATE TABLE " + nft.Ownership{}.TableName()).Error
+	if err != nil {
+		return err
+	}
+	if len(ownerships) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(ownerships, 1000).Error
+}
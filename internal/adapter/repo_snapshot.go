@@ -0,0 +1,195 @@
+package adapter
+
+import (
+	"context"
+	"flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/inscription"
+	"flow-indexer/internal/domain/snapshot"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	snapshotTable = snapshot.Snapshot{}.TableName()
+	eventTable    = event.FlowEvent{}.TableName()
+
+	// eventDelta is the balance change of an event row, see
+	// event.FlowEvent.IsDeposit.
+	eventDelta = "CASE WHEN event LIKE '%" + event.DepositSuffix + "' THEN 1 ELSE -1 END"
+)
+
+type snapshotRepo struct {
+	db *gorm.DB
+}
+
+func NewSnapshotRepo(db *gorm.DB) snapshot.Repository {
+	return &snapshotRepo{db: db}
+}
+
+func (r *snapshotRepo) Create(ctx context.Context, height uint64) error {
+	db := conn(ctx, r.db)
+	base, err := r.latestHeight(db, height-1)
+	if err != nil {
+		return err
+	}
+
+	err = db.Where("height = ?", height).Delete(&snapshot.Snapshot{}).Error
+	if err != nil {
+		return err
+	}
+	// a concurrent commit may take the same snapshot, the last one wins
+	err = db.Exec(
+		"INSERT INTO "+snapshotTable+" (inscription, account, height, amount, created_at, updated_at) "+
+			"SELECT inscription, account, ?, SUM(amount), now(), now() FROM ("+
+			"SELECT inscription, account, amount FROM "+snapshotTable+" WHERE height = ? "+
+			"UNION ALL "+
+			"SELECT inscription, account, "+eventDelta+" FROM "+eventTable+" WHERE block > ? AND block <= ?"+
+			") t GROUP BY inscription, account HAVING SUM(amount) <> 0 "+
+			"ON CONFLICT (inscription, height, account) DO UPDATE SET amount = EXCLUDED.amount, updated_at = EXCLUDED.updated_at",
+		height, base, base, height,
+	).Error
+	if err != nil {
+		return err
+	}
+
+	// the height is recorded even if no balance was written, so that it is
+	// not taken again
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "height"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at"}),
+	}).Create(&snapshot.Height{Height: height}).Error
+}
+
+func (r *snapshotRepo) LatestHeight(ctx context.Context) (uint64, error) {
+	return r.latestHeight(conn(ctx, r.db), math.MaxInt64)
+}
+
+func (r *snapshotRepo) BalanceAt(ctx context.Context, insName, address string, height uint64) (int64, error) {
+	db := conn(ctx, r.db)
+	base, err := r.latestHeight(db, height)
+	if err != nil {
+		return 0, err
+	}
+
+	var amount int64
+	err = db.Raw(
+		"SELECT COALESCE(SUM(amount), 0) FROM ("+
+			"SELECT amount FROM "+snapshotTable+" WHERE inscription = ? AND account = ? AND height = ? "+
+			"UNION ALL "+
+			"SELECT "+eventDelta+" FROM "+eventTable+" WHERE inscription = ? AND account = ? AND block > ? AND block <= ?"+
+			") t",
+		insName, address, base, insName, address, base, height,
+	).Scan(&amount).Error
+	if err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+func (r *snapshotRepo) HoldersAt(ctx context.Context, insName string, height uint64) ([]snapshot.Snapshot, error) {
+	db := conn(ctx, r.db)
+	base, err := r.latestHeight(db, height)
+	if err != nil {
+		return nil, err
+	}
+
+	var holders []snapshot.Snapshot
+	err = db.Raw(
+		"SELECT inscription, account, CAST(? AS bigint) AS height, SUM(amount) AS amount FROM ("+
+			"SELECT inscription, account, amount FROM "+snapshotTable+" WHERE inscription = ? AND height = ? "+
+			"UNION ALL "+
+			"SELECT inscription, account, "+eventDelta+" FROM "+eventTable+" WHERE inscription = ? AND block > ? AND block <= ?"+
+			") t WHERE account <> '' GROUP BY inscription, account HAVING SUM(amount) > 0 ORDER BY amount DESC, account",
+		height, insName, base, insName, base, height,
+	).Scan(&holders).Error
+	if err != nil {
+		return nil, err
+	}
+	return holders, nil
+}
+
+func (r *snapshotRepo) LeaderboardAt(
+	ctx context.Context, insName string, height uint64, after *inscription.Cursor, limit int,
+) ([]inscription.Holder, error) {
+	db := conn(ctx, r.db)
+	base, err := r.latestHeight(db, height)
+	if err != nil {
+		return nil, err
+	}
+
+	page := "TRUE"
+	args := []interface{}{insName, base, insName, base, height}
+	if after != nil {
+		page = "(amount < ? OR (amount = ? AND account > ?))"
+		args = append(args, after.Amount, after.Amount, after.Account)
+	}
+	args = append(args, limit, insName)
+
+	var holders []inscription.Holder
+	err = db.Raw(
+		"WITH ranked AS ("+
+			"SELECT account, SUM(amount) AS amount, RANK() OVER (ORDER BY SUM(amount) DESC) AS rank FROM ("+
+			"SELECT account, amount FROM "+snapshotTable+" WHERE inscription = ? AND height = ? "+
+			"UNION ALL "+
+			"SELECT account, "+eventDelta+" FROM "+eventTable+" WHERE inscription = ? AND block > ? AND block <= ?"+
+			") t WHERE account <> '' GROUP BY account HAVING SUM(amount) > 0"+
+			"), page AS ("+
+			"SELECT rank, account, amount FROM ranked WHERE "+page+" ORDER BY amount DESC, account LIMIT ?"+
+			") "+
+			"SELECT p.rank, p.account, p.amount, COALESCE(b.first_seen_height, 0) AS first_seen_height FROM page p "+
+			"LEFT JOIN "+inscription.Balance{}.TableName()+" b ON b.account = p.account AND b.inscription = ? "+
+			"ORDER BY p.amount DESC, p.account",
+		args...,
+	).Scan(&holders).Error
+	if err != nil {
+		return nil, err
+	}
+	return holders, nil
+}
+
+func (r *snapshotRepo) HolderCountAt(ctx context.Context, insName string, height uint64) (int64, error) {
+	db := conn(ctx, r.db)
+	base, err := r.latestHeight(db, height)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = db.Raw(
+		"SELECT COUNT(*) FROM (SELECT account FROM ("+
+			"SELECT account, amount FROM "+snapshotTable+" WHERE inscription = ? AND height = ? "+
+			"UNION ALL "+
+			"SELECT account, "+eventDelta+" FROM "+eventTable+" WHERE inscription = ? AND block > ? AND block <= ?"+
+			") t WHERE account <> '' GROUP BY account HAVING SUM(amount) > 0) h",
+		insName, base, insName, base, height,
+	).Scan(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *snapshotRepo) DeleteAbove(ctx context.Context, height uint64) error {
+	db := conn(ctx, r.db)
+	err := db.Where("height > ?", height).Delete(&snapshot.Snapshot{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Where("height > ?", height).Delete(&snapshot.Height{}).Error
+}
+
+// latestHeight returns the latest height up to maxHeight snapshots were
+// taken at, or 0 if there is none.
+func (r *snapshotRepo) latestHeight(db *gorm.DB, maxHeight uint64) (uint64, error) {
+	var base uint64
+	err := db.Model(&snapshot.Height{}).
+		Select("COALESCE(MAX(height), 0)").
+		Where("height <= ?", maxHeight).
+		Scan(&base).Error
+	if err != nil {
+		return 0, err
+	}
+	return base, nil
+}
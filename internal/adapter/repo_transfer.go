@@ -0,0 +1,78 @@
+package adapter
+
+import (
+	"context"
+	"flow-indexer/internal/domain/transfer"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type transferRepo struct {
+	db *gorm.DB
+}
+
+func NewTransferRepo(db *gorm.DB) transfer.Repository {
+	return &transferRepo{db: db}
+}
+
+func (r *transferRepo) Save(ctx context.Context, transfers []transfer.Transfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	return conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "inscription"}, {Name: "nft_id"}, {Name: "transaction_id"}, {Name: "event_index"},
+		},
+		DoUpdates: clause.AssignmentColumns([]string{"kind", "updated_at"}),
+	}).Create(&transfers).Error
+}
+
+func (r *transferRepo) ListByNFTIDs(ctx context.Context, insName string, nftIDs []uint64) ([]transfer.Transfer, error) {
+	if len(nftIDs) == 0 {
+		return nil, nil
+	}
+
+	var transfers []transfer.Transfer
+	err := conn(ctx, r.db).
+		Where("inscription = ? AND nft_id IN ?", insName, nftIDs).
+		Order("block, transaction_index, event_index").
+		Find(&transfers).Error
+	if err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (r *transferRepo) CountAt(ctx context.Context, insName string, height uint64) (*transfer.Counts, error) {
+	table := transfer.Transfer{}.TableName()
+	var counts transfer.Counts
+	err := conn(ctx, r.db).Raw(
+		"SELECT "+
+			"(SELECT COUNT(*) FROM "+table+" WHERE inscription = ? AND block <= ? AND kind = ?) AS minted, "+
+			"COUNT(*) FILTER (WHERE kind = ?) AS burned, "+
+			"COUNT(*) FILTER (WHERE kind <> ? AND to_account = '') AS escrowed "+
+			"FROM ("+
+			"SELECT DISTINCT ON (nft_id) kind, to_account FROM "+table+" "+
+			"WHERE inscription = ? AND block <= ? "+
+			"ORDER BY nft_id, block DESC, transaction_index DESC, event_index DESC"+
+			") t",
+		insName, height, transfer.KindMint,
+		transfer.KindBurn,
+		transfer.KindBurn,
+		insName, height,
+	).Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return &counts, nil
+}
+
+func (r *transferRepo) DeleteAbove(ctx context.Context, height uint64) ([]transfer.Transfer, error) {
+	var deleted []transfer.Transfer
+	err := conn(ctx, r.db).Clauses(clause.Returning{}).Where("block > ?", height).Delete(&deleted).Error
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	flowUtils "flow-indexer/pkg/flow"
+	gormpkg "flow-indexer/pkg/gorm"
+	"flow-indexer/pkg/log"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Config is the configuration of the indexer and API binaries. Fields tagged
+// secret are redacted when the configuration is printed.
+type Config struct {
+	Log      Log      `yaml:"log" toml:"log"`
+	Database Database `yaml:"database" toml:"database"`
+	Flow     Flow     `yaml:"flow" toml:"flow"`
+	Scanner  Scanner  `yaml:"scanner" toml:"scanner"`
+	API      API      `yaml:"api" toml:"api"`
+}
+
+type Log struct {
+	// Level is one of debug, info, warn and error.
+	Level  string `yaml:"level" toml:"level"`
+	Stdout bool   `yaml:"stdout" toml:"stdout"`
+	// File is the path of a rotated log file, no file logging if empty.
+	File string `yaml:"file" toml:"file"`
+}
+
+type Database struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password" secret:"true"`
+	Name     string `yaml:"name" toml:"name"`
+	SSLMode  string `yaml:"sslmode" toml:"sslmode"`
+	// DSN overrides the connection fields above if set.
+	DSN             string        `yaml:"dsn" toml:"dsn" secret:"true"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+type Flow struct {
+	// AccessNode is the gRPC address of the Flow access node.
+	AccessNode string `yaml:"access_node" toml:"access_node"`
+	// MaxMsgSize is the largest response accepted from the access node, in
+	// bytes.
+	MaxMsgSize int `yaml:"max_msg_size" toml:"max_msg_size"`
+}
+
+type Scanner struct {
+	// Threads is the number of batches fetched in parallel.
+	Threads int `yaml:"threads" toml:"threads"`
+	// MaxBlockQuery is the number of blocks of a single event query, the
+	// access node serves at most 250 blocks per query.
+	MaxBlockQuery uint64 `yaml:"max_block_query" toml:"max_block_query"`
+	// StartBlock and EndBlock bound the backfill. Heights already scanned
+	// are skipped, so they can change between runs.
+	StartBlock uint64 `yaml:"start_block" toml:"start_block"`
+	EndBlock   uint64 `yaml:"end_block" toml:"end_block"`
+	// Follow keeps indexing the chain head once the backfill is done.
+	Follow       bool          `yaml:"follow" toml:"follow"`
+	FinalityLag  uint64        `yaml:"finality_lag" toml:"finality_lag"`
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	EventTypes   []string      `yaml:"event_types" toml:"event_types"`
+	// ShutdownTimeout bounds the wait for the batch being committed when the
+	// indexer is stopped.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type API struct {
+	HTTPAddr string `yaml:"http_addr" toml:"http_addr"`
+	GRPCAddr string `yaml:"grpc_addr" toml:"grpc_addr"`
+}
+
+// Default returns the configuration used for the settings that are not
+// configured.
+func Default() Config {
+	return Config{
+		Log: Log{
+			Level:  "info",
+			Stdout: true,
+		},
+		Database: Database{
+			Host:            "db",
+			Port:            "5432",
+			User:            "abc",
+			Password:        "",
+			Name:            "postgres",
+			SSLMode:         "disable",
+			MaxIdleConns:    2,
+			MaxOpenConns:    2,
+			ConnMaxLifetime: 10 * time.Minute,
+		},
+		Flow: Flow{
+			AccessNode: "access.mainnet.nodes.onflow.org:9000",
+			MaxMsgSize: 50 * 1024 * 1024, // 50MB
+		},
+		Scanner: Scanner{
+			Threads:       15,
+			MaxBlockQuery: 249,
+			StartBlock:    68277132, // freeflow deployment block
+			EndBlock:      69434891,
+			Follow:        true,
+			FinalityLag:   10,
+			PollInterval:  5 * time.Second,
+			EventTypes: []string{
+				flowUtils.FreeflowDepositEventType,
+				flowUtils.FreeflowWithdrawEventType,
+			},
+			ShutdownTimeout: 30 * time.Second,
+		},
+		API: API{
+			HTTPAddr: ":8080",
+			GRPCAddr: ":9090",
+		},
+	}
+}
+
+// Validate reports every invalid setting read by the binary name, "indexer"
+// or "api". The log and database settings are read by both.
+func (c Config) Validate(name string) error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	_, err := zapcore.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level: unknown level %q", c.Log.Level)
+
+	if c.Database.DSN == "" {
+		check(c.Database.Host != "", "database.host is required")
+		check(c.Database.User != "", "database.user is required")
+		check(c.Database.Password != "", "database.password is required, set FLOW_INDEXER_DATABASE_PASSWORD or database.dsn")
+		check(c.Database.Name != "", "database.name is required")
+	}
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns must be positive")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+
+	switch name {
+	case "indexer":
+		check(c.Flow.AccessNode != "", "flow.access_node is required")
+		check(c.Flow.MaxMsgSize > 0, "flow.max_msg_size must be positive")
+
+		check(c.Scanner.Threads > 0, "scanner.threads must be positive")
+		check(c.Scanner.MaxBlockQuery > 0 && c.Scanner.MaxBlockQuery <= 250,
+			"scanner.max_block_query must be between 1 and 250")
+		check(c.Scanner.StartBlock <= c.Scanner.EndBlock,
+			"scanner.start_block %d is after scanner.end_block %d", c.Scanner.StartBlock, c.Scanner.EndBlock)
+		check(!c.Scanner.Follow || c.Scanner.PollInterval > 0, "scanner.poll_interval must be positive to follow")
+		check(len(c.Scanner.EventTypes) > 0, "scanner.event_types is required")
+		check(c.Scanner.ShutdownTimeout > 0, "scanner.shutdown_timeout must be positive")
+	case "api":
+		check(validAddr(c.API.HTTPAddr), "api.http_addr: invalid address %q", c.API.HTTPAddr)
+		check(validAddr(c.API.GRPCAddr), "api.grpc_addr: invalid address %q", c.API.GRPCAddr)
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func validAddr(addr string) bool {
+	_, _, err := net.SplitHostPort(addr)
+	return err == nil
+}
+
+// ConnString returns the connection string of the database.
+func (d Database) ConnString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     net.JoinHostPort(d.Host, d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: "sslmode=" + url.QueryEscape(d.SSLMode),
+	}
+	return u.String()
+}
+
+// LogConfig returns the logger configuration of the binary called name.
+func (c Config) LogConfig(name string) log.Config {
+	// validated already
+	level, _ := zapcore.ParseLevel(c.Log.Level)
+	return log.Config{
+		Name:   name,
+		Level:  level,
+		Stdout: c.Log.Stdout,
+		File:   c.Log.File,
+	}
+}
+
+// GormConfig returns the database connection configuration.
+func (c Config) GormConfig() gormpkg.Config {
+	return gormpkg.Config{
+		DSN:             c.Database.ConnString(),
+		MaxIdleConns:    c.Database.MaxIdleConns,
+		MaxOpenConns:    c.Database.MaxOpenConns,
+		ConnMaxLifetime: c.Database.ConnMaxLifetime,
+		SingularTable:   true,
+	}
+}
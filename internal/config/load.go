@@ -0,0 +1,256 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables overriding settings, e.g.
+// FLOW_INDEXER_DATABASE_PASSWORD overrides database.password.
+const EnvPrefix = "FLOW_INDEXER_"
+
+const redacted = "******"
+
+// setting is a leaf of the configuration, named by the path of its keys,
+// e.g. scanner.start_block.
+type setting struct {
+	key    string
+	value  reflect.Value
+	secret bool
+}
+
+// env returns the environment variable overriding s.
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// settings returns the leaves of c, setting them sets c.
+func settings(c *Config) []setting {
+	var out []setting
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := prefix + f.Tag.Get("yaml")
+			if f.Type.Kind() == reflect.Struct {
+				walk(key+".", v.Field(i))
+				continue
+			}
+			out = append(out, setting{key: key, value: v.Field(i), secret: f.Tag.Get("secret") == "true"})
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem())
+	return out
+}
+
+// set parses text into the setting.
+func (s setting) set(text string) error {
+	v := s.value
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(text)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.ParseInt(text, 10, 0)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// settingFlag records the value of a setting flag, settings are only set
+// once the file and the environment are applied.
+type settingFlag struct {
+	setting
+	flags map[string]string
+}
+
+func (f *settingFlag) String() string {
+	return ""
+}
+
+func (f *settingFlag) Set(text string) error {
+	// fail early on malformed values
+	err := setting{value: reflect.New(f.value.Type()).Elem()}.set(text)
+	if err != nil {
+		return err
+	}
+	f.flags[f.key] = text
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.setting.value.Kind() == reflect.Bool
+}
+
+// Load builds the configuration from def, the file given with -config or
+// FLOW_INDEXER_CONFIG, the environment and the setting flags, each overriding
+// the previous ones, and validates it. Every setting has a flag named by its
+// key, e.g. -scanner.start_block. It returns the arguments left after the
+// flags. Only the settings read by the binary name are validated, see
+// Validate.
+func Load(name string, def Config, args []string) (Config, []string, error) {
+	c := def
+	all := settings(&c)
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "configuration `file`, YAML or TOML by extension")
+	flags := make(map[string]string)
+	for _, s := range all {
+		usage := fmt.Sprintf("overrides %s (env %s)", s.key, s.env())
+		fs.Var(&settingFlag{s, flags}, s.key, usage)
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	if *path != "" {
+		err = readFile(*path, &c)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("read config %s: %w", *path, err)
+		}
+	}
+
+	for _, s := range all {
+		text, ok := os.LookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		err = s.set(text)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("%s: %w", s.env(), err)
+		}
+	}
+
+	for _, s := range all {
+		text, ok := flags[s.key]
+		if !ok {
+			continue
+		}
+		err = s.set(text)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("-%s: %w", s.key, err)
+		}
+	}
+
+	err = c.Validate(name)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return c, fs.Args(), nil
+}
+
+// readFile decodes the file at path into c, rejecting unknown keys.
+func readFile(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown key %s", undecoded[0])
+		}
+		return nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(c)
+	if err == io.EOF {
+		// empty file
+		return nil
+	}
+	return err
+}
+
+// Redacted returns a copy of c with the secrets masked.
+func (c Config) Redacted() Config {
+	c.Scanner.EventTypes = append([]string(nil), c.Scanner.EventTypes...)
+	for _, s := range settings(&c) {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(redacted)
+		}
+	}
+	return c
+}
+
+// Command runs the config subcommand of a binary. config print [-format
+// yaml|toml] writes c with its secrets redacted.
+func Command(c Config, args []string, w io.Writer) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: config print [-format yaml|toml]")
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	format := fs.String("format", "yaml", "output `format`, yaml or toml")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	return Write(w, c.Redacted(), *format)
+}
+
+// Write writes c to w as YAML, or as TOML if format is toml.
+func Write(w io.Writer, c Config, format string) error {
+	switch format {
+	case "yaml", "":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		err := enc.Encode(c)
+		if err != nil {
+			return err
+		}
+		return enc.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(c)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
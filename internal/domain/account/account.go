@@ -7,7 +7,7 @@ import (
 
 type Account struct {
 	domain.Base
-	Address string `gorm:"column:address;type:varchar(42);primary_key" json:"address"`
+	Address string `gorm:"column:address;type:varchar(16);primary_key" json:"address"`
 }
 
 type Repository interface {
@@ -0,0 +1,24 @@
+package account
+
+import "strings"
+
+// AddressLength is the length of a stored address, the 8 bytes of a Flow
+// address in lower case hex without 0x.
+const AddressLength = 16
+
+// NormalizeAddress returns a Flow address in the form it is stored: lower
+// case, without 0x and padded with the leading zeros Flow tools often omit.
+// Strings that are not Flow addresses are only lowercased and stripped of 0x,
+// so they don't match any account.
+func NormalizeAddress(address string) string {
+	address = strings.TrimPrefix(strings.ToLower(address), "0x")
+	if address == "" || len(address) > AddressLength {
+		return address
+	}
+	for _, c := range address {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return address
+		}
+	}
+	return strings.Repeat("0", AddressLength-len(address)) + address
+}
@@ -0,0 +1,30 @@
+package account
+
+import "testing"
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    string
+	}{
+		{"normalized", "88dd257fcf26d3cc", "88dd257fcf26d3cc"},
+		{"0x prefix", "0x88dd257fcf26d3cc", "88dd257fcf26d3cc"},
+		{"upper case", "0X88DD257FCF26D3CC", "88dd257fcf26d3cc"},
+		{"leading zero omitted", "0xe467b9dd11fa00d", "0e467b9dd11fa00d"},
+		{"service account", "0x1", "0000000000000001"},
+		{"no prefix", "ABC", "0000000000000abc"},
+		{"empty", "", ""},
+		{"0x only", "0x", ""},
+		{"too long", "0x188dd257fcf26d3cc", "188dd257fcf26d3cc"},
+		{"not hex", "0xnot-an-address", "not-an-address"},
+		{"mixed case not hex", "Alice", "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeAddress(tt.address); got != tt.want {
+				t.Errorf("NormalizeAddress(%q) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package anomaly
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Anomaly records an event that made a balance negative, which usually means
+// events were applied out of order or an earlier event is missing.
+type Anomaly struct {
+	domain.Base
+	ID               uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	Inscription      string    `gorm:"column:inscription;type:varchar(256);index"`
+	Account          string    `gorm:"column:account;index"`
+	Event            string    `gorm:"column:event;type:varchar(256)"`
+	NFTID            uint64    `gorm:"column:nft_id;type:bigint;default:0"`
+	Block            uint64    `gorm:"column:block;type:bigint;default:0"`
+	TransactionID    string    `gorm:"column:transaction_id;type:varchar(64);default:''"`
+	TransactionIndex int       `gorm:"column:transaction_index;type:integer;default:0"`
+	EventIndex       int       `gorm:"column:event_index;type:integer;default:0"`
+	Amount           int64     `gorm:"column:amount;type:bigint;default:0"`
+}
+
+type Repository interface {
+	Create(ctx context.Context, anomaly *Anomaly) error
+	// List returns anomalies in chain order, all of them if inscription is
+	// empty.
+	List(ctx context.Context, inscription string) ([]Anomaly, error)
+	// Delete removes the anomalies of inscription, all of them if it is
+	// empty.
+	Delete(ctx context.Context, inscription string) error
+}
+
+func (Anomaly) TableName() string {
+	return domain.FlowInscriptionPrefix + "anomaly"
+}
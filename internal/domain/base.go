@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"context"
+	"errors"
 	"time"
 )
 
@@ -8,7 +10,12 @@ const (
 	FlowInscriptionPrefix = "flow_inscription_"
 )
 
+// ErrNotFound is returned by repositories when the requested record does not
+// exist.
+var ErrNotFound = errors.New("record not found")
+
 // ForeignKeyConstraint defines the required arguments to the AddForeignKey call.
+// Dest is the referenced table and column, e.g. table(column).
 type ForeignKeyConstraint struct {
 	Field    string
 	Dest     string
@@ -41,3 +48,10 @@ type Base struct {
 	UpdatedAt time.Time `gorm:"column:updated_at;type:timestamp with time zone" json:"-"`
 	CreatedAt time.Time `gorm:"column:created_at;type:timestamp with time zone" json:"-"`
 }
+
+// Transactor runs fn in a database transaction. Repository calls made with
+// the context passed to fn take part in that transaction, which is committed
+// when fn returns nil and rolled back otherwise.
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -0,0 +1,102 @@
+package checkpoint
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+	"sort"
+)
+
+// Checkpoint records the last committed height of a block range scanned for
+// a given event type. The range is only a name for the progress of one scan,
+// the heights scanned are the union of the committed parts of every range,
+// see Completed.
+type Checkpoint struct {
+	domain.Base
+	EventType  string `gorm:"column:event_type;type:varchar(256);primaryKey"`
+	StartBlock uint64 `gorm:"column:start_block;type:bigint;primaryKey;autoIncrement:false"`
+	EndBlock   uint64 `gorm:"column:end_block;type:bigint;primaryKey;autoIncrement:false"`
+	Height     uint64 `gorm:"column:height;type:bigint;default:0"`
+}
+
+// Interval is a range of block heights, both ends included.
+type Interval struct {
+	Start uint64
+	End   uint64
+}
+
+type Repository interface {
+	Save(ctx context.Context, checkpoint *Checkpoint) error
+	// List returns every checkpoint by event type and range.
+	List(ctx context.Context) ([]Checkpoint, error)
+	// Rewind removes the checkpoints of the ranges starting above height and
+	// moves the others back to height if they are past it.
+	Rewind(ctx context.Context, height uint64) error
+}
+
+func (Checkpoint) TableName() string {
+	return domain.FlowInscriptionPrefix + "checkpoint"
+}
+
+// Done returns the heights the range of c has committed so far, false if it
+// hasn't committed any.
+func (c Checkpoint) Done() (Interval, bool) {
+	if c.Height == 0 || c.Height < c.StartBlock {
+		return Interval{}, false
+	}
+	return Interval{Start: c.StartBlock, End: c.Height}, true
+}
+
+// Completed returns the heights committed by checkpoints as sorted, disjoint
+// intervals. Overlapping and adjacent intervals are merged.
+func Completed(checkpoints []Checkpoint) []Interval {
+	var done []Interval
+	for _, c := range checkpoints {
+		if i, ok := c.Done(); ok {
+			done = append(done, i)
+		}
+	}
+	sort.Slice(done, func(a, b int) bool {
+		return done[a].Start < done[b].Start
+	})
+
+	var merged []Interval
+	for _, i := range done {
+		if n := len(merged); n > 0 && i.Start <= merged[n-1].End+1 {
+			if i.End > merged[n-1].End {
+				merged[n-1].End = i.End
+			}
+			continue
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
+
+// Missing returns the parts of [from, to] that completed, sorted and disjoint
+// as Completed returns them, doesn't cover.
+func Missing(completed []Interval, from, to uint64) []Interval {
+	var missing []Interval
+	next := from
+	for _, i := range completed {
+		if next > to {
+			return missing
+		}
+		if i.End < next {
+			continue
+		}
+		if i.Start > to {
+			break
+		}
+		if i.Start > next {
+			missing = append(missing, Interval{Start: next, End: i.Start - 1})
+		}
+		if i.End >= to {
+			return missing
+		}
+		next = i.End + 1
+	}
+	if next <= to {
+		missing = append(missing, Interval{Start: next, End: to})
+	}
+	return missing
+}
@@ -0,0 +1,115 @@
+package checkpoint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompleted(t *testing.T) {
+	tests := []struct {
+		name        string
+		checkpoints []Checkpoint
+		want        []Interval
+	}{
+		{
+			name: "none committed",
+			checkpoints: []Checkpoint{
+				{StartBlock: 100, EndBlock: 200},
+				{StartBlock: 300, EndBlock: 400, Height: 250},
+			},
+		},
+		{
+			name: "disjoint ranges",
+			checkpoints: []Checkpoint{
+				{StartBlock: 300, EndBlock: 400, Height: 320},
+				{StartBlock: 100, EndBlock: 200, Height: 200},
+			},
+			want: []Interval{{100, 200}, {300, 320}},
+		},
+		{
+			name: "adjacent ranges",
+			checkpoints: []Checkpoint{
+				{StartBlock: 100, EndBlock: 200, Height: 200},
+				{StartBlock: 201, EndBlock: 300, Height: 300},
+			},
+			want: []Interval{{100, 300}},
+		},
+		{
+			name: "ranges of another split",
+			checkpoints: []Checkpoint{
+				{StartBlock: 100, EndBlock: 199, Height: 150},
+				{StartBlock: 100, EndBlock: 300, Height: 120},
+				{StartBlock: 140, EndBlock: 400, Height: 180},
+			},
+			want: []Interval{{100, 180}},
+		},
+		{
+			name: "follow range",
+			checkpoints: []Checkpoint{
+				{StartBlock: 100, EndBlock: 200, Height: 150},
+				{StartBlock: 201, EndBlock: 0, Height: 500},
+			},
+			want: []Interval{{100, 150}, {201, 500}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Completed(tt.checkpoints)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Completed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissing(t *testing.T) {
+	tests := []struct {
+		name      string
+		completed []Interval
+		from, to  uint64
+		want      []Interval
+	}{
+		{
+			name: "nothing scanned",
+			from: 100, to: 200,
+			want: []Interval{{100, 200}},
+		},
+		{
+			name:      "all scanned",
+			completed: []Interval{{50, 300}},
+			from:      100, to: 200,
+		},
+		{
+			name:      "resume",
+			completed: []Interval{{100, 150}},
+			from:      100, to: 200,
+			want: []Interval{{151, 200}},
+		},
+		{
+			name:      "gaps",
+			completed: []Interval{{10, 20}, {110, 120}, {150, 160}, {190, 250}},
+			from:      100, to: 200,
+			want: []Interval{{100, 109}, {121, 149}, {161, 189}},
+		},
+		{
+			name:      "outside the range",
+			completed: []Interval{{10, 20}, {300, 400}},
+			from:      100, to: 200,
+			want: []Interval{{100, 200}},
+		},
+		{
+			name:      "end scanned",
+			completed: []Interval{{150, 200}},
+			from:      100, to: 200,
+			want: []Interval{{100, 149}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Missing(tt.completed, tt.from, tt.to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Missing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
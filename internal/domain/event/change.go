@@ -0,0 +1,79 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Change is a committed event together with the balance of its account right
+// after it. Balance is nil for changes replayed from the event log.
+type Change struct {
+	FlowEvent
+	Balance *int64 `json:"balance,omitempty"`
+}
+
+// ChangeFilter selects changes. Zero values match everything.
+type ChangeFilter struct {
+	Account     string
+	Inscription string
+	// Event is either a full event type or deposit or withdraw.
+	Event string
+}
+
+// Match reports whether e passes the filter.
+func (f ChangeFilter) Match(e *FlowEvent) bool {
+	if f.Account != "" && f.Account != e.Account {
+		return false
+	}
+	if f.Inscription != "" && f.Inscription != e.Inscription {
+		return false
+	}
+	switch strings.ToLower(f.Event) {
+	case "":
+		return true
+	case "deposit":
+		return e.IsDeposit()
+	case "withdraw":
+		return !e.IsDeposit()
+	default:
+		return f.Event == e.Event
+	}
+}
+
+// Publisher notifies listeners of changes. Changes published inside a
+// transaction are only delivered once it commits.
+type Publisher interface {
+	Publish(ctx context.Context, changes []Change) error
+}
+
+// Position returns the place of the event in the chain.
+func (e FlowEvent) Position() Position {
+	return Position{Block: e.Block, TransactionIndex: e.TransactionIndex, EventIndex: e.EventIndex}
+}
+
+// Less reports whether p comes before o in the chain.
+func (p Position) Less(o Position) bool {
+	if p.Block != o.Block {
+		return p.Block < o.Block
+	}
+	if p.TransactionIndex != o.TransactionIndex {
+		return p.TransactionIndex < o.TransactionIndex
+	}
+	return p.EventIndex < o.EventIndex
+}
+
+// String formats p as block-transactionIndex-eventIndex.
+func (p Position) String() string {
+	return fmt.Sprintf("%d-%d-%d", p.Block, p.TransactionIndex, p.EventIndex)
+}
+
+// ParsePosition parses the output of Position.String.
+func ParsePosition(s string) (Position, error) {
+	var p Position
+	_, err := fmt.Sscanf(s, "%d-%d-%d", &p.Block, &p.TransactionIndex, &p.EventIndex)
+	if err != nil {
+		return Position{}, fmt.Errorf("invalid position %q: %w", s, err)
+	}
+	return p, nil
+}
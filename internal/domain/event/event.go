@@ -3,23 +3,117 @@ package event
 import (
 	"context"
 	"flow-indexer/internal/domain"
+	"flow-indexer/internal/domain/account"
+	"strings"
 
 	uuid "github.com/satori/go.uuid"
 )
 
+// FlowEvent is an indexed on-chain event. An event is identified by its
+// transaction and its position in the block, rows ingested before those
+// columns existed are left out of the unique index. Rows ingested before
+// the inscription column existed all belong to freeflow.
 type FlowEvent struct {
 	domain.Base
-	ID      uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
-	NFTID   uint64    `gorm:"column:nft_id;type:integer;default:0"`
-	Account string    `gorm:"column:account;foreignKey;index;reference:Address"`
-	Event   string    `gorm:"column:event;type:varchar(256);index"`
-	Block   uint64    `gorm:"column:block;type:integer;default:0"`
+	ID               uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()" json:"-"`
+	NFTID            uint64    `gorm:"column:nft_id;type:bigint;default:0;index:idx_flow_event_nft,priority:2" json:"nft_id"`
+	Account          string    `gorm:"column:account;index;index:idx_flow_event_account_position,priority:1" json:"account"`
+	Inscription      string    `gorm:"column:inscription;type:varchar(256);default:'freeflow';index;index:idx_flow_event_inscription_block,priority:1;index:idx_flow_event_nft,priority:1" json:"inscription"`
+	Event            string    `gorm:"column:event;type:varchar(256);index" json:"event"`
+	Block            uint64    `gorm:"column:block;type:bigint;default:0;index:idx_flow_event_account_position,priority:2;index:idx_flow_event_inscription_block,priority:2" json:"block"`
+	TransactionID    string    `gorm:"column:transaction_id;type:varchar(64);default:'';uniqueIndex:idx_flow_event_identity,where:transaction_id <> ''" json:"transaction_id"`
+	TransactionIndex int       `gorm:"column:transaction_index;type:integer;default:0;uniqueIndex:idx_flow_event_identity;index:idx_flow_event_account_position,priority:3" json:"transaction_index"`
+	EventIndex       int       `gorm:"column:event_index;type:integer;default:0;uniqueIndex:idx_flow_event_identity;index:idx_flow_event_account_position,priority:4" json:"event_index"`
+}
+
+// Position is the place of an event in the chain.
+type Position struct {
+	Block            uint64
+	TransactionIndex int
+	EventIndex       int
+}
+
+// Activity is an event of an account together with the transfer it is part
+// of, if any. Counterparty is the other side of the transfer.
+type Activity struct {
+	FlowEvent
+	TransferKind string `gorm:"column:transfer_kind" json:"transfer_kind,omitempty"`
+	Counterparty string `gorm:"column:counterparty" json:"counterparty,omitempty"`
+}
+
+// ActivityFilter narrows down the activity of an account. Zero values match
+// everything.
+type ActivityFilter struct {
+	Inscription string
+	// Event is either a full event type or deposit or withdraw.
+	Event      string
+	FromHeight uint64
+	ToHeight   uint64
+	// After is the position of the last activity of the previous page.
+	After *Position
+	Limit int
 }
 
 type Repository interface {
-	Create(ctx context.Context, event *FlowEvent) error
+	// Create inserts event and reports false if it was already ingested.
+	Create(ctx context.Context, event *FlowEvent) (bool, error)
+	// Iterate calls fn for every event of inscription, or of all
+	// inscriptions if it is empty, in chain order. fn must not use the
+	// database as the events are streamed from an open cursor.
+	Iterate(ctx context.Context, inscription string, fn func(event *FlowEvent) error) error
+	// ListByAccount returns the events of address, latest first.
+	ListByAccount(ctx context.Context, address string, limit, offset int) ([]FlowEvent, error)
+	// ListActivity returns the events of address matching filter in chain
+	// order, joined with their transfers.
+	ListActivity(ctx context.Context, address string, filter ActivityFilter) ([]Activity, error)
+	// ListByAccounts returns the events of every address matching filter in
+	// chain order, at most filter.Limit per address.
+	ListByAccounts(ctx context.Context, addresses []string, filter ActivityFilter) ([]FlowEvent, error)
+	// ListByNFTID returns the events of an NFT in chain order.
+	ListByNFTID(ctx context.Context, inscription string, nftID uint64) ([]FlowEvent, error)
+	// ListChanges returns up to limit events matching filter after position
+	// after, in chain order.
+	ListChanges(ctx context.Context, filter ChangeFilter, after Position, limit int) ([]FlowEvent, error)
+	// DeleteAbove removes the events of the blocks above height.
+	DeleteAbove(ctx context.Context, height uint64) error
+}
+
+// DepositSuffix ends the type of every Deposit event, e.g.
+// A.88dd257fcf26d3cc.Inscription.Deposit.
+const DepositSuffix = ".Deposit"
+
+// IsDeposit reports whether the event moved the NFT into the account, as
+// opposed to a Withdraw moving it out.
+func (e FlowEvent) IsDeposit() bool {
+	return strings.HasSuffix(e.Event, DepositSuffix)
+}
+
+// Delta returns the change the event makes to the balance of its account.
+func (e FlowEvent) Delta() int64 {
+	if e.IsDeposit() {
+		return 1
+	}
+	return -1
 }
 
 func (FlowEvent) TableName() string {
 	return domain.FlowInscriptionPrefix + "event"
 }
+
+// Indexes serves the reads of events in chain order, e.g. the change
+// replay, and the deletions above a height.
+func (FlowEvent) Indexes() []domain.CustomIndex {
+	return []domain.CustomIndex{{
+		Name:   "idx_flow_event_position",
+		Fields: []string{"block", "transaction_index", "event_index"},
+	}}
+}
+
+func (FlowEvent) ForeignKeyConstraints() []domain.ForeignKeyConstraint {
+	return []domain.ForeignKeyConstraint{{
+		Field:    "account",
+		Dest:     account.Account{}.TableName() + "(address)",
+		OnDelete: "RESTRICT",
+		OnUpdate: "CASCADE",
+	}}
+}
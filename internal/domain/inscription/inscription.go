@@ -2,24 +2,100 @@ package inscription
 
 import (
 	"context"
+	"encoding/base64"
 	"flow-indexer/internal/domain"
+	"flow-indexer/internal/domain/account"
+	"fmt"
+	"strconv"
+	"strings"
 
 	uuid "github.com/satori/go.uuid"
 )
 
 type Balance struct {
 	domain.Base
-	ID          uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
-	Account     string    `gorm:"column:account;foreignKey;index;reference:Address"`
-	Inscription string    `gorm:"column:inscription;type:varchar(256);index"`
-	Amount      uint64    `gorm:"column:amount;type:integer;default:0"`
+	ID          uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()" json:"-"`
+	Account     string    `gorm:"column:account;index;uniqueIndex:idx_balance_account_inscription;index:idx_balance_leaderboard,priority:3" json:"account"`
+	Inscription string    `gorm:"column:inscription;type:varchar(256);index;uniqueIndex:idx_balance_account_inscription;index:idx_balance_leaderboard,priority:1" json:"inscription"`
+	Amount      int64     `gorm:"column:amount;type:bigint;default:0;index:idx_balance_leaderboard,priority:2,sort:desc" json:"amount"`
+	// FirstSeenHeight is the block of the first event of the balance.
+	FirstSeenHeight uint64 `gorm:"column:first_seen_height;type:bigint;default:0" json:"-"`
+}
+
+// Holder is a row of the holder leaderboard of an inscription. Holders with
+// the same amount share a rank. Share is the fraction of the total supply
+// held.
+type Holder struct {
+	Rank            int64   `json:"rank"`
+	Account         string  `json:"account"`
+	Amount          int64   `json:"amount"`
+	Share           float64 `json:"share"`
+	FirstSeenHeight uint64  `json:"first_seen_height"`
+}
+
+// Cursor is the position of the last holder of a leaderboard page. Height is
+// the height the leaderboard is ranked at, the next pages keep it.
+type Cursor struct {
+	Height  uint64
+	Amount  int64
+	Account string
+}
+
+// String encodes c as the opaque page cursor every API hands out.
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%s", c.Height, c.Amount, c.Account)))
+}
+
+// ParseCursor decodes a page cursor returned by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	parts := strings.SplitN(string(b), ":", 3)
+	if len(parts) != 3 {
+		return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	height, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	amount, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	return Cursor{Height: height, Amount: amount, Account: parts[2]}, nil
 }
 
 type Repository interface {
-	GetorCreateByInscriptionAndAddress(ctx context.Context, inscription, address string) (*Balance, error)
-	Update(ctx context.Context, balance *Balance) error
+	// AddAmount atomically adds delta to the balance of address for
+	// inscription at block, creating the balance if needed, and returns the
+	// new amount. The balance keeps the lowest block as FirstSeenHeight.
+	AddAmount(ctx context.Context, inscription, address string, delta int64, block uint64) (int64, error)
+	// Replace swaps the balances of inscription, or all balances if it is
+	// empty, for balances.
+	Replace(ctx context.Context, inscription string, balances []Balance) error
+	// ListByAccount returns the non-zero balances of address.
+	ListByAccount(ctx context.Context, address string) ([]Balance, error)
+	// List returns the balances of inscription, or every balance if it is
+	// empty, including the zero ones.
+	List(ctx context.Context, inscription string) ([]Balance, error)
+	// ListByAccounts returns the non-zero balances of every address.
+	ListByAccounts(ctx context.Context, addresses []string) ([]Balance, error)
+	// ListHolders returns the positive balances of inscription, largest
+	// first.
+	ListHolders(ctx context.Context, inscription string, limit, offset int) ([]Balance, error)
 }
 
 func (Balance) TableName() string {
 	return domain.FlowInscriptionPrefix + "balance"
 }
+
+func (Balance) ForeignKeyConstraints() []domain.ForeignKeyConstraint {
+	return []domain.ForeignKeyConstraint{{
+		Field:    "account",
+		Dest:     account.Account{}.TableName() + "(address)",
+		OnDelete: "RESTRICT",
+		OnUpdate: "CASCADE",
+	}}
+}
@@ -0,0 +1,37 @@
+package nft
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+)
+
+// Ownership is the current owner of an inscription NFT. Owner is empty while
+// the NFT is not held by an account, e.g. between a Withdraw and a Deposit
+// or when it was deposited into a collection without an owner.
+type Ownership struct {
+	domain.Base
+	Inscription    string `gorm:"column:inscription;type:varchar(256);primaryKey" json:"inscription"`
+	NFTID          uint64 `gorm:"column:nft_id;type:bigint;primaryKey;autoIncrement:false" json:"nft_id"`
+	Owner          string `gorm:"column:owner;index" json:"owner"`
+	AcquiredHeight uint64 `gorm:"column:acquired_height;type:bigint;default:0" json:"acquired_height"`
+	LastTransferTx string `gorm:"column:last_transfer_tx;type:varchar(64);default:''" json:"last_transfer_tx"`
+}
+
+type Repository interface {
+	// Save creates or replaces the ownership of an NFT.
+	Save(ctx context.Context, ownership *Ownership) error
+	// GetByNFTID returns domain.ErrNotFound if the NFT was never seen.
+	GetByNFTID(ctx context.Context, inscription string, nftID uint64) (*Ownership, error)
+	ListByOwner(ctx context.Context, inscription, owner string) ([]Ownership, error)
+	// ListByNFTIDs returns the ownerships of the NFTs that were seen among
+	// nftIDs.
+	ListByNFTIDs(ctx context.Context, inscription string, nftIDs []uint64) ([]Ownership, error)
+	// ListByOwners returns the first limit NFTs by id of every owner.
+	ListByOwners(ctx context.Context, inscription string, owners []string, limit int) ([]Ownership, error)
+	// Replace swaps every ownership for ownerships.
+	Replace(ctx context.Context, ownerships []Ownership) error
+}
+
+func (Ownership) TableName() string {
+	return domain.FlowInscriptionPrefix + "nft"
+}
@@ -0,0 +1,65 @@
+package snapshot
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+	"flow-indexer/internal/domain/inscription"
+)
+
+// Snapshot is the balance of an account for an inscription as of a block
+// height. Snapshots are taken periodically so that historical balances can be
+// computed from the closest snapshot instead of the whole event log.
+type Snapshot struct {
+	domain.Base
+	Inscription string `gorm:"column:inscription;type:varchar(256);primaryKey"`
+	Height      uint64 `gorm:"column:height;type:bigint;primaryKey;autoIncrement:false"`
+	Account     string `gorm:"column:account;primaryKey"`
+	Amount      int64  `gorm:"column:amount;type:bigint;default:0"`
+}
+
+// Height records a height snapshots were taken at, even if every balance
+// was zero and no Snapshot row was written.
+type Height struct {
+	domain.Base
+	Height uint64 `gorm:"column:height;type:bigint;primaryKey;autoIncrement:false"`
+}
+
+type Repository interface {
+	// Create snapshots every non-zero balance as of height, from the latest
+	// snapshot below it and the events since, and records height as taken. A
+	// snapshot taken at height before is replaced.
+	Create(ctx context.Context, height uint64) error
+	// LatestHeight returns the latest height snapshots were taken at, 0 if
+	// there is none.
+	LatestHeight(ctx context.Context) (uint64, error)
+	// BalanceAt returns the balance of address for inscription as of height.
+	BalanceAt(ctx context.Context, inscription, address string, height uint64) (int64, error)
+	// HoldersAt returns every positive balance of inscription held by an
+	// account as of height, largest first.
+	HoldersAt(ctx context.Context, inscription string, height uint64) ([]Snapshot, error)
+	// LeaderboardAt ranks the accounts holding inscription as of height by
+	// balance, and returns up to limit of them ranked after after, from the
+	// top if it is nil. Share is left to the caller.
+	LeaderboardAt(ctx context.Context, inscription string, height uint64, after *inscription.Cursor, limit int) ([]inscription.Holder, error)
+	// HolderCountAt counts the accounts holding inscription as of height.
+	HolderCountAt(ctx context.Context, inscription string, height uint64) (int64, error)
+	// DeleteAbove removes the snapshots taken above height.
+	DeleteAbove(ctx context.Context, height uint64) error
+}
+
+func (Snapshot) TableName() string {
+	return domain.FlowInscriptionPrefix + "snapshot"
+}
+
+func (Height) TableName() string {
+	return domain.FlowInscriptionPrefix + "snapshot_height"
+}
+
+// Indexes serve the removal of the snapshots above a height, which spans the
+// inscriptions.
+func (Snapshot) Indexes() []domain.CustomIndex {
+	return []domain.CustomIndex{{
+		Name:   "idx_snapshot_height",
+		Fields: []string{"height"},
+	}}
+}
@@ -0,0 +1,101 @@
+package transfer
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+	"flow-indexer/internal/domain/event"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// KindMint is the first Deposit of an NFT, without a Withdraw of the
+	// NFT in its transaction.
+	KindMint = "mint"
+	// KindReturn is a later Deposit without a Withdraw of the same NFT in its
+	// transaction, the NFT comes back from escrow.
+	KindReturn = "return"
+	// KindTransfer is a Withdraw paired with a Deposit of the same NFT in the
+	// same transaction. An empty From or To is a move out of or into escrow,
+	// i.e. a collection that is not owned by an account.
+	KindTransfer = "transfer"
+	// KindEscrow is a Withdraw without a Deposit of the same NFT in its
+	// transaction whose NFT is deposited again later, it was held in escrow
+	// meanwhile.
+	KindEscrow = "escrow"
+	// KindBurn is a Withdraw without a Deposit of the same NFT in its
+	// transaction whose NFT is never deposited again. It becomes a KindEscrow
+	// once the NFT is.
+	KindBurn = "burn"
+)
+
+// Transfer is a movement of an NFT between accounts, derived from the
+// Withdraw and Deposit events of a transaction. The position is the one of
+// the last event of the pair.
+type Transfer struct {
+	domain.Base
+	ID               uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()" json:"-"`
+	Inscription      string    `gorm:"column:inscription;type:varchar(256);uniqueIndex:idx_transfer_identity" json:"inscription"`
+	NFTID            uint64    `gorm:"column:nft_id;type:bigint;default:0;uniqueIndex:idx_transfer_identity" json:"nft_id"`
+	Kind             string    `gorm:"column:kind;type:varchar(16);index" json:"kind"`
+	From             string    `gorm:"column:from_account;index" json:"from"`
+	To               string    `gorm:"column:to_account;index" json:"to"`
+	Block            uint64    `gorm:"column:block;type:bigint;default:0" json:"block"`
+	TransactionID    string    `gorm:"column:transaction_id;type:varchar(64);uniqueIndex:idx_transfer_identity" json:"transaction_id"`
+	TransactionIndex int       `gorm:"column:transaction_index;type:integer;default:0" json:"transaction_index"`
+	EventIndex       int       `gorm:"column:event_index;type:integer;default:0;uniqueIndex:idx_transfer_identity" json:"event_index"`
+}
+
+// Counts are the NFTs of an inscription by state as of a height.
+type Counts struct {
+	// Minted counts the NFTs minted so far.
+	Minted int64
+	// Burned counts the NFTs whose latest transfer is a burn.
+	Burned int64
+	// Escrowed counts the NFTs held by no account that are not burned, whose
+	// latest transfer is an escrow move or a move into escrow.
+	Escrowed int64
+}
+
+type Repository interface {
+	// Save inserts transfers, or updates the kind of those that exist.
+	Save(ctx context.Context, transfers []Transfer) error
+	// ListByNFTIDs returns the transfers of the NFTs of inscription among
+	// nftIDs in chain order.
+	ListByNFTIDs(ctx context.Context, inscription string, nftIDs []uint64) ([]Transfer, error)
+	// CountAt counts the NFTs of inscription by state as of height.
+	CountAt(ctx context.Context, inscription string, height uint64) (*Counts, error)
+	// DeleteAbove removes the transfers of the blocks above height and
+	// returns them.
+	DeleteAbove(ctx context.Context, height uint64) ([]Transfer, error)
+}
+
+// IsDeposit reports whether the transfer ends with a Deposit of its NFT, as
+// opposed to a Withdraw left unpaired.
+func (t Transfer) IsDeposit() bool {
+	return t.Kind != KindEscrow && t.Kind != KindBurn
+}
+
+// Position returns the place of the transfer in the chain.
+func (t Transfer) Position() event.Position {
+	return event.Position{Block: t.Block, TransactionIndex: t.TransactionIndex, EventIndex: t.EventIndex}
+}
+
+func (Transfer) TableName() string {
+	return domain.FlowInscriptionPrefix + "transfer"
+}
+
+// Indexes serve the transfers of an NFT, the latest one as of a height, see
+// Repository.CountAt, and the deletions above a height.
+func (Transfer) Indexes() []domain.CustomIndex {
+	return []domain.CustomIndex{
+		{
+			Name:   "idx_transfer_nft_position",
+			Fields: []string{"inscription", "nft_id", "block DESC", "transaction_index DESC", "event_index DESC"},
+		},
+		{
+			Name:   "idx_transfer_block",
+			Fields: []string{"block"},
+		},
+	}
+}
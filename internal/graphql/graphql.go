@@ -0,0 +1,121 @@
+package graphql
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"flow-indexer/internal/service"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+)
+
+const (
+	maxDepth       = 10
+	maxParallelism = 100
+	maxFirst       = 1000
+	maxAddresses   = 100
+)
+
+//go:embed schema.graphql
+var schema string
+
+// NewSchema returns the GraphQL schema of the query API. Requests must be
+// executed with a context prepared by NewContext.
+func NewSchema(svc service.Service) *graphqlgo.Schema {
+	return graphqlgo.MustParseSchema(schema, &Resolver{svc: svc},
+		graphqlgo.MaxDepth(maxDepth),
+		graphqlgo.MaxParallelism(maxParallelism),
+	)
+}
+
+// internalError logs err, a service error, and returns the error shown to the
+// client in its place, which doesn't leak the details.
+func internalError(msg string, err error) error {
+	zap.L().Error(msg, zap.Error(err))
+	return errors.New("internal error")
+}
+
+type ctxKey struct{}
+
+// request is the state shared by the resolvers of one request.
+type request struct {
+	loaders *loaders
+
+	mu   sync.Mutex
+	cost int
+	max  int
+}
+
+// NewContext prepares ctx for executing one request. The request may cost at
+// most maxCost, every list costs the number of items it asks for and every
+// object looked up by key costs one. Resolvers exceeding the budget fail
+// before querying the database.
+func NewContext(ctx context.Context, maxCost int) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &request{
+		loaders: newLoaders(),
+		max:     maxCost,
+	})
+}
+
+func fromContext(ctx context.Context) *request {
+	req, ok := ctx.Value(ctxKey{}).(*request)
+	if !ok {
+		panic("graphql: request context not prepared by NewContext")
+	}
+	return req
+}
+
+// charge adds n to the cost of the request.
+func charge(ctx context.Context, n int) error {
+	req := fromContext(ctx)
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	req.cost += n
+	if req.cost > req.max {
+		return fmt.Errorf("query cost exceeds %d", req.max)
+	}
+	return nil
+}
+
+// Long is the GraphQL scalar for 64-bit integers.
+type Long int64
+
+func (Long) ImplementsGraphQLType(name string) bool {
+	return name == "Long"
+}
+
+func (l *Long) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case int32:
+		*l = Long(input)
+	case int64:
+		*l = Long(input)
+	case float64:
+		*l = Long(input)
+	case json.Number:
+		n, err := input.Int64()
+		if err != nil {
+			return err
+		}
+		*l = Long(n)
+	case string:
+		n, err := strconv.ParseInt(input, 10, 64)
+		if err != nil {
+			return err
+		}
+		*l = Long(n)
+	default:
+		return fmt.Errorf("wrong type for Long: %T", input)
+	}
+	return nil
+}
+
+func (l Long) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(l), 10), nil
+}
@@ -0,0 +1,225 @@
+package graphql
+
+import (
+	"context"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/inscription"
+	"flow-indexer/internal/domain/nft"
+	"flow-indexer/internal/service"
+	"sync"
+	"time"
+)
+
+const (
+	// loadWait is how long a loader collects keys before fetching them.
+	loadWait     = 2 * time.Millisecond
+	maxBatchSize = 500
+)
+
+// loader batches the loads made by concurrent resolvers into a single fetch,
+// so that resolving a field of every item of a list costs one query instead
+// of one per item. The errors of fetch are returned to the client as they
+// are.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu    sync.Mutex
+	batch *batch[K, V]
+}
+
+type batch[K comparable, V any] struct {
+	keys    []K
+	seen    map[K]struct{}
+	once    sync.Once
+	done    chan struct{}
+	results map[K]V
+	err     error
+}
+
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch}
+}
+
+// load returns the value of key, the zero value if it doesn't exist.
+func (l *loader[K, V]) load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	b := l.batch
+	if b == nil {
+		b = &batch[K, V]{seen: make(map[K]struct{}), done: make(chan struct{})}
+		l.batch = b
+		time.AfterFunc(loadWait, func() { l.run(ctx, b) })
+	}
+	if _, ok := b.seen[key]; !ok {
+		b.seen[key] = struct{}{}
+		b.keys = append(b.keys, key)
+	}
+	if len(b.keys) >= maxBatchSize {
+		l.batch = nil
+		go l.run(ctx, b)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.results[key], b.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *loader[K, V]) run(ctx context.Context, b *batch[K, V]) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.batch == b {
+			l.batch = nil
+		}
+		l.mu.Unlock()
+
+		b.results, b.err = l.fetch(ctx, b.keys)
+		close(b.done)
+	})
+}
+
+// eventsArgs are the arguments shared by the event lists fetched together.
+type eventsArgs struct {
+	Inscription string
+	Event       string
+	FromHeight  uint64
+	ToHeight    uint64
+	After       flowEvent.Position
+	HasAfter    bool
+	Limit       int
+}
+
+// ownedNFTsArgs are the arguments shared by the NFT lists fetched together.
+type ownedNFTsArgs struct {
+	Inscription string
+	Limit       int
+}
+
+type nftKey struct {
+	Inscription string
+	ID          uint64
+}
+
+// loaders are the loaders of one request. Lists are only batched with the
+// lists asking for the same arguments.
+type loaders struct {
+	mu        sync.Mutex
+	balances  *loader[string, []inscription.Balance]
+	events    map[eventsArgs]*loader[string, []flowEvent.FlowEvent]
+	nfts      *loader[nftKey, *nft.Ownership]
+	ownedNFTs map[ownedNFTsArgs]*loader[string, []nft.Ownership]
+}
+
+func newLoaders() *loaders {
+	return &loaders{
+		events:    make(map[eventsArgs]*loader[string, []flowEvent.FlowEvent]),
+		ownedNFTs: make(map[ownedNFTsArgs]*loader[string, []nft.Ownership]),
+	}
+}
+
+// balancesLoader loads the non-zero balances of an address.
+func (l *loaders) balancesLoader(svc service.Service) *loader[string, []inscription.Balance] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.balances == nil {
+		l.balances = newLoader(func(ctx context.Context, addresses []string) (map[string][]inscription.Balance, error) {
+			balances, err := svc.ListBalancesByAccounts(ctx, addresses)
+			if err != nil {
+				return nil, internalError("ListBalancesByAccounts", err)
+			}
+			byAccount := make(map[string][]inscription.Balance)
+			for _, b := range balances {
+				byAccount[b.Account] = append(byAccount[b.Account], b)
+			}
+			return byAccount, nil
+		})
+	}
+	return l.balances
+}
+
+// eventsLoader loads the events of an address matching args.
+func (l *loaders) eventsLoader(svc service.Service, args eventsArgs) *loader[string, []flowEvent.FlowEvent] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ld, ok := l.events[args]; ok {
+		return ld
+	}
+
+	filter := flowEvent.ActivityFilter{
+		Inscription: args.Inscription,
+		Event:       args.Event,
+		FromHeight:  args.FromHeight,
+		ToHeight:    args.ToHeight,
+		Limit:       args.Limit,
+	}
+	if args.HasAfter {
+		after := args.After
+		filter.After = &after
+	}
+	ld := newLoader(func(ctx context.Context, addresses []string) (map[string][]flowEvent.FlowEvent, error) {
+		events, err := svc.ListEventsByAccounts(ctx, addresses, filter)
+		if err != nil {
+			return nil, internalError("ListEventsByAccounts", err)
+		}
+		byAccount := make(map[string][]flowEvent.FlowEvent)
+		for _, e := range events {
+			byAccount[e.Account] = append(byAccount[e.Account], e)
+		}
+		return byAccount, nil
+	})
+	l.events[args] = ld
+	return ld
+}
+
+// nftLoader loads the ownership of an NFT, nil if it was never seen.
+func (l *loaders) nftLoader(svc service.Service) *loader[nftKey, *nft.Ownership] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.nfts == nil {
+		l.nfts = newLoader(func(ctx context.Context, keys []nftKey) (map[nftKey]*nft.Ownership, error) {
+			ids := make(map[string][]uint64)
+			for _, k := range keys {
+				ids[k.Inscription] = append(ids[k.Inscription], k.ID)
+			}
+			ownerships := make(map[nftKey]*nft.Ownership)
+			for insName, nftIDs := range ids {
+				found, err := svc.GetOwnerships(ctx, insName, nftIDs)
+				if err != nil {
+					return nil, internalError("GetOwnerships", err)
+				}
+				for i := range found {
+					ownerships[nftKey{insName, found[i].NFTID}] = &found[i]
+				}
+			}
+			return ownerships, nil
+		})
+	}
+	return l.nfts
+}
+
+// ownedNFTsLoader loads the first args.Limit NFTs of args.Inscription held by
+// an address.
+func (l *loaders) ownedNFTsLoader(svc service.Service, args ownedNFTsArgs) *loader[string, []nft.Ownership] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ld, ok := l.ownedNFTs[args]; ok {
+		return ld
+	}
+
+	ld := newLoader(func(ctx context.Context, owners []string) (map[string][]nft.Ownership, error) {
+		ownerships, err := svc.ListOwnershipsByOwners(ctx, args.Inscription, owners, args.Limit)
+		if err != nil {
+			return nil, internalError("ListOwnershipsByOwners", err)
+		}
+		byOwner := make(map[string][]nft.Ownership)
+		for _, o := range ownerships {
+			byOwner[o.Owner] = append(byOwner[o.Owner], o)
+		}
+		return byOwner, nil
+	})
+	l.ownedNFTs[args] = ld
+	return ld
+}
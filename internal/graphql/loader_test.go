@@ -0,0 +1,104 @@
+package graphql
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fetches records the batches a loader fetched.
+type fetches struct {
+	mu      sync.Mutex
+	batches [][]int
+}
+
+func (f *fetches) fetch(_ context.Context, keys []int) (map[int]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, append([]int{}, keys...))
+	results := make(map[int]int, len(keys))
+	for _, k := range keys {
+		results[k] = k * 10
+	}
+	return results, nil
+}
+
+func (f *fetches) get() [][]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.batches
+}
+
+func TestLoaderTimeoutFlush(t *testing.T) {
+	f := &fetches{}
+	l := newLoader(f.fetch)
+
+	// a batch short of maxBatchSize is fetched once loadWait is over
+	v, err := l.load(context.Background(), 1)
+	if err != nil || v != 10 {
+		t.Fatalf("load(1) = %d, %v, want 10", v, err)
+	}
+	if got := f.get(); !reflect.DeepEqual(got, [][]int{{1}}) {
+		t.Fatalf("fetched batches %v, want one with 1", got)
+	}
+
+	// a load after the flush starts a new batch
+	_, err = l.load(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.get(); len(got) != 2 || !reflect.DeepEqual(got[1], []int{3}) {
+		t.Errorf("fetched batches %v, want a second one with 3", got)
+	}
+}
+
+func TestLoaderSizeFlush(t *testing.T) {
+	f := &fetches{}
+	l := newLoader(f.fetch)
+
+	// a batch one key short of full, without the timer that would flush it
+	b := &batch[int, int]{seen: make(map[int]struct{}), done: make(chan struct{})}
+	for k := 0; k < maxBatchSize-1; k++ {
+		b.seen[k] = struct{}{}
+		b.keys = append(b.keys, k)
+	}
+	l.batch = b
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, err := l.load(context.Background(), maxBatchSize-1)
+		if err != nil || v != (maxBatchSize-1)*10 {
+			t.Errorf("load() = %d, %v", v, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a full batch was not fetched")
+	}
+
+	batches := f.get()
+	if len(batches) != 1 || len(batches[0]) != maxBatchSize {
+		t.Errorf("fetched %d batches, want 1 of %d keys", len(batches), maxBatchSize)
+	}
+	if l.batch != nil {
+		t.Error("the full batch is still collecting keys")
+	}
+}
+
+func TestLoaderCanceled(t *testing.T) {
+	l := newLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := l.load(ctx, 1)
+	if err != context.Canceled {
+		t.Errorf("load() error = %v, want %v", err, context.Canceled)
+	}
+}
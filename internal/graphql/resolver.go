@@ -0,0 +1,389 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"flow-indexer/internal/domain/account"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/inscription"
+	"flow-indexer/internal/domain/nft"
+	"flow-indexer/internal/service"
+	"fmt"
+)
+
+// Resolver resolves the Query type.
+type Resolver struct {
+	svc service.Service
+}
+
+// checkFirst validates the size of a page and charges it to the request.
+func checkFirst(ctx context.Context, first int32) error {
+	if first <= 0 || first > maxFirst {
+		return fmt.Errorf("first must be between 1 and %d", maxFirst)
+	}
+	return charge(ctx, int(first))
+}
+
+func (r *Resolver) Account(ctx context.Context, args struct{ Address string }) (*accountResolver, error) {
+	err := charge(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &accountResolver{r, account.NormalizeAddress(args.Address)}, nil
+}
+
+func (r *Resolver) Accounts(ctx context.Context, args struct{ Addresses []string }) ([]*accountResolver, error) {
+	if len(args.Addresses) > maxAddresses {
+		return nil, fmt.Errorf("at most %d addresses can be queried", maxAddresses)
+	}
+	err := charge(ctx, len(args.Addresses))
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*accountResolver, len(args.Addresses))
+	for i, a := range args.Addresses {
+		accounts[i] = &accountResolver{r, account.NormalizeAddress(a)}
+	}
+	return accounts, nil
+}
+
+func (r *Resolver) Holders(ctx context.Context, args struct {
+	Inscription string
+	First       int32
+	After       *string
+}) (*holderConnection, error) {
+	err := checkFirst(ctx, args.First)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor *inscription.Cursor
+	if args.After != nil {
+		after, err := inscription.ParseCursor(*args.After)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		cursor = &after
+	}
+
+	holders, height, err := r.svc.Leaderboard(ctx, args.Inscription, cursor, int(args.First)+1)
+	if err != nil {
+		return nil, internalError("Leaderboard", err)
+	}
+
+	conn := &holderConnection{}
+	if len(holders) > int(args.First) {
+		holders = holders[:args.First]
+		conn.pageInfo.hasNextPage = true
+	}
+	for _, h := range holders {
+		conn.nodes = append(conn.nodes, &holderResolver{r, h})
+	}
+	if len(holders) > 0 {
+		last := holders[len(holders)-1]
+		end := inscription.Cursor{Height: height, Amount: last.Amount, Account: last.Account}.String()
+		conn.pageInfo.endCursor = &end
+	}
+	return conn, nil
+}
+
+func (r *Resolver) NFT(ctx context.Context, args struct {
+	Inscription string
+	ID          Long
+}) (*nftResolver, error) {
+	err := charge(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := fromContext(ctx).loaders.nftLoader(r.svc).load(ctx, nftKey{args.Inscription, uint64(args.ID)})
+	if err != nil || o == nil {
+		return nil, err
+	}
+	return &nftResolver{r, *o}, nil
+}
+
+type accountResolver struct {
+	r       *Resolver
+	address string
+}
+
+func (a *accountResolver) Address() string {
+	return a.address
+}
+
+func (a *accountResolver) Balances(ctx context.Context, args struct{ Inscription *string }) ([]*balanceResolver, error) {
+	err := charge(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := fromContext(ctx).loaders.balancesLoader(a.r.svc).load(ctx, a.address)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolvers []*balanceResolver
+	for _, b := range balances {
+		if args.Inscription != nil && *args.Inscription != b.Inscription {
+			continue
+		}
+		resolvers = append(resolvers, &balanceResolver{a.r, b})
+	}
+	return resolvers, nil
+}
+
+type eventFilter struct {
+	Inscription *string
+	Event       *string
+	FromHeight  *Long
+	ToHeight    *Long
+}
+
+func (a *accountResolver) Events(ctx context.Context, args struct {
+	Filter *eventFilter
+	First  int32
+	After  *string
+}) (*eventConnection, error) {
+	var ea eventsArgs
+	if f := args.Filter; f != nil {
+		if f.Inscription != nil {
+			ea.Inscription = *f.Inscription
+		}
+		if f.Event != nil {
+			ea.Event = *f.Event
+		}
+		if f.FromHeight != nil {
+			ea.FromHeight = uint64(*f.FromHeight)
+		}
+		if f.ToHeight != nil {
+			ea.ToHeight = uint64(*f.ToHeight)
+		}
+	}
+	return loadEvents(ctx, a.r, a.address, ea, args.First, args.After)
+}
+
+func (a *accountResolver) NFTs(ctx context.Context, args struct {
+	Inscription string
+	First       int32
+}) ([]*nftResolver, error) {
+	err := checkFirst(ctx, args.First)
+	if err != nil {
+		return nil, err
+	}
+
+	ld := fromContext(ctx).loaders.ownedNFTsLoader(a.r.svc, ownedNFTsArgs{args.Inscription, int(args.First)})
+	ownerships, err := ld.load(ctx, a.address)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*nftResolver, len(ownerships))
+	for i, o := range ownerships {
+		resolvers[i] = &nftResolver{a.r, o}
+	}
+	return resolvers, nil
+}
+
+// loadEvents returns a page of the events of address. Cursors are event
+// positions.
+func loadEvents(ctx context.Context, r *Resolver, address string, args eventsArgs, first int32, after *string) (*eventConnection, error) {
+	err := checkFirst(ctx, first)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		args.After, err = flowEvent.ParsePosition(*after)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		args.HasAfter = true
+	}
+	// one more to tell whether there is a next page
+	args.Limit = int(first) + 1
+
+	events, err := fromContext(ctx).loaders.eventsLoader(r.svc, args).load(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &eventConnection{}
+	if len(events) > int(first) {
+		events = events[:first]
+		conn.pageInfo.hasNextPage = true
+	}
+	for _, e := range events {
+		conn.nodes = append(conn.nodes, &eventResolver{r, e})
+	}
+	if len(events) > 0 {
+		end := events[len(events)-1].Position().String()
+		conn.pageInfo.endCursor = &end
+	}
+	return conn, nil
+}
+
+type balanceResolver struct {
+	r *Resolver
+	b inscription.Balance
+}
+
+func (b *balanceResolver) Account() *accountResolver {
+	return &accountResolver{b.r, b.b.Account}
+}
+
+func (b *balanceResolver) Inscription() string {
+	return b.b.Inscription
+}
+
+func (b *balanceResolver) Amount() Long {
+	return Long(b.b.Amount)
+}
+
+func (b *balanceResolver) Events(ctx context.Context, args struct {
+	Event *string
+	First int32
+	After *string
+}) (*eventConnection, error) {
+	ea := eventsArgs{Inscription: b.b.Inscription}
+	if args.Event != nil {
+		ea.Event = *args.Event
+	}
+	return loadEvents(ctx, b.r, b.b.Account, ea, args.First, args.After)
+}
+
+type eventResolver struct {
+	r *Resolver
+	e flowEvent.FlowEvent
+}
+
+func (e *eventResolver) Account() *accountResolver {
+	return &accountResolver{e.r, e.e.Account}
+}
+
+func (e *eventResolver) Inscription() string {
+	return e.e.Inscription
+}
+
+func (e *eventResolver) Event() string {
+	return e.e.Event
+}
+
+func (e *eventResolver) NFTID() Long {
+	return Long(e.e.NFTID)
+}
+
+func (e *eventResolver) Block() Long {
+	return Long(e.e.Block)
+}
+
+func (e *eventResolver) TransactionID() string {
+	return e.e.TransactionID
+}
+
+func (e *eventResolver) TransactionIndex() int32 {
+	return int32(e.e.TransactionIndex)
+}
+
+func (e *eventResolver) EventIndex() int32 {
+	return int32(e.e.EventIndex)
+}
+
+func (e *eventResolver) NFT(ctx context.Context) (*nftResolver, error) {
+	return e.r.NFT(ctx, struct {
+		Inscription string
+		ID          Long
+	}{e.e.Inscription, Long(e.e.NFTID)})
+}
+
+type holderResolver struct {
+	r *Resolver
+	h inscription.Holder
+}
+
+func (h *holderResolver) Rank() Long {
+	return Long(h.h.Rank)
+}
+
+func (h *holderResolver) Account() *accountResolver {
+	return &accountResolver{h.r, h.h.Account}
+}
+
+func (h *holderResolver) Amount() Long {
+	return Long(h.h.Amount)
+}
+
+func (h *holderResolver) Share() float64 {
+	return h.h.Share
+}
+
+func (h *holderResolver) FirstSeenHeight() Long {
+	return Long(h.h.FirstSeenHeight)
+}
+
+type nftResolver struct {
+	r *Resolver
+	o nft.Ownership
+}
+
+func (n *nftResolver) Inscription() string {
+	return n.o.Inscription
+}
+
+func (n *nftResolver) ID() Long {
+	return Long(n.o.NFTID)
+}
+
+func (n *nftResolver) Owner() *accountResolver {
+	if n.o.Owner == "" {
+		return nil
+	}
+	return &accountResolver{n.r, n.o.Owner}
+}
+
+func (n *nftResolver) AcquiredHeight() Long {
+	return Long(n.o.AcquiredHeight)
+}
+
+func (n *nftResolver) LastTransferTx() string {
+	return n.o.LastTransferTx
+}
+
+type pageInfo struct {
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (p *pageInfo) EndCursor() *string {
+	return p.endCursor
+}
+
+func (p *pageInfo) HasNextPage() bool {
+	return p.hasNextPage
+}
+
+type eventConnection struct {
+	nodes    []*eventResolver
+	pageInfo pageInfo
+}
+
+func (c *eventConnection) Nodes() []*eventResolver {
+	return c.nodes
+}
+
+func (c *eventConnection) PageInfo() *pageInfo {
+	return &c.pageInfo
+}
+
+type holderConnection struct {
+	nodes    []*holderResolver
+	pageInfo pageInfo
+}
+
+func (c *holderConnection) Nodes() []*holderResolver {
+	return c.nodes
+}
+
+func (c *holderConnection) PageInfo() *pageInfo {
+	return &c.pageInfo
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"flow-indexer/internal/domain/account"
+	flowEvent "flow-indexer/internal/domain/event"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAccountBalances returns the non-zero balances of an account.
+func (h Handler) GetAccountBalances(c *gin.Context) {
+	address := account.NormalizeAddress(c.Param("address"))
+
+	balances, err := h.service.ListBalances(c.Request.Context(), address)
+	if err != nil {
+		internalError(c, "ListBalances", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"address":  address,
+		"balances": balances,
+	})
+}
+
+// GetAccountEvents returns a page of the events of an account, latest first.
+func (h Handler) GetAccountEvents(c *gin.Context) {
+	address := account.NormalizeAddress(c.Param("address"))
+	limit, offset, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.service.ListEvents(c.Request.Context(), address, limit, offset)
+	if err != nil {
+		internalError(c, "ListEvents", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"address": address,
+		"limit":   limit,
+		"offset":  offset,
+		"events":  events,
+	})
+}
+
+// GetAccountActivity returns a page of the events of an account in chain
+// order, with the counterparty of each transfer. Results can be narrowed down
+// by inscription, event type and height range, and pages are chained with the
+// cursor of the previous page.
+func (h Handler) GetAccountActivity(c *gin.Context) {
+	address := account.NormalizeAddress(c.Param("address"))
+	limit, _, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	filter := flowEvent.ActivityFilter{
+		Inscription: c.Query("inscription"),
+		Event:       c.Query("event"),
+		Limit:       limit,
+	}
+	if filter.FromHeight, ok = queryUint64(c, "from_height"); !ok {
+		return
+	}
+	if filter.ToHeight, ok = queryUint64(c, "to_height"); !ok {
+		return
+	}
+	if v := c.Query("cursor"); v != "" {
+		after, err := flowEvent.ParsePosition(v)
+		if err != nil {
+			badRequest(c, "invalid cursor")
+			return
+		}
+		filter.After = &after
+	}
+
+	activities, err := h.service.ListActivity(c.Request.Context(), address, filter)
+	if err != nil {
+		internalError(c, "ListActivity", err)
+		return
+	}
+
+	next := ""
+	if len(activities) == limit {
+		next = activities[len(activities)-1].Position().String()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"address":     address,
+		"activities":  activities,
+		"next_cursor": next,
+	})
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"flow-indexer/internal/graphql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxQueryCost bounds the number of items a GraphQL request may ask for.
+const maxQueryCost = 10000
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL executes a GraphQL query over accounts, balances, events and NFTs.
+func (h Handler) GraphQL(c *gin.Context) {
+	var req graphqlRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		badRequest(c, "invalid request body")
+		return
+	}
+
+	ctx := graphql.NewContext(c.Request.Context(), maxQueryCost)
+	c.JSON(http.StatusOK, h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
@@ -1,13 +1,91 @@
 package handler
 
 import (
+	"flow-indexer/internal/graphql"
 	"flow-indexer/internal/service"
+	"flow-indexer/internal/stream"
+	"flow-indexer/pkg/api/middlewares"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
 )
 
 type Handler struct {
 	service service.Service
+	hub     *stream.Hub
+	schema  *graphqlgo.Schema
+}
+
+func NewHandler(service service.Service, hub *stream.Hub) Handler {
+	return Handler{service, hub, graphql.NewSchema(service)}
+}
+
+// Register adds the routes of the query API to r.
+func (h Handler) Register(r gin.IRouter) {
+	r.GET("/accounts/:address/balances", h.GetAccountBalances)
+	r.GET("/accounts/:address/events", h.GetAccountEvents)
+	r.GET("/accounts/:address/activity", h.GetAccountActivity)
+	r.GET("/inscriptions/:inscription/holders", h.GetInscriptionHolders)
+	r.GET("/inscriptions/:inscription/leaderboard", h.GetInscriptionLeaderboard)
+	r.GET("/inscriptions/:inscription/nfts/:id/provenance", h.GetNFTProvenance)
+	r.GET("/stream/events", h.StreamEvents)
+	r.GET("/stream/balances", h.WatchBalances)
+	r.POST("/graphql", h.GraphQL)
+}
+
+// pagination reads the limit and offset query parameters.
+func pagination(c *gin.Context) (limit, offset int, ok bool) {
+	limit, offset = defaultLimit, 0
+	var err error
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			badRequest(c, "limit must be between 1 and "+strconv.Itoa(maxLimit))
+			return 0, 0, false
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			badRequest(c, "offset must be a non-negative integer")
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+// queryUint64 reads an optional unsigned integer query parameter, 0 if it is
+// missing.
+func queryUint64(c *gin.Context, name string) (uint64, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		badRequest(c, name+" must be a non-negative integer")
+		return 0, false
+	}
+	return n, true
+}
+
+func badRequest(c *gin.Context, msg string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+}
+
+func notFound(c *gin.Context, msg string) {
+	c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": msg})
 }
 
-func NewHandler(service service.Service) Handler {
-	return Handler{service}
+func internalError(c *gin.Context, msg string, err error) {
+	middlewares.GetLogger(c).Error(msg, zap.Error(err))
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
 }
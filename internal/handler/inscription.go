@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"flow-indexer/internal/domain/inscription"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetInscriptionHolders returns a page of the holders of an inscription,
+// largest balance first.
+func (h Handler) GetInscriptionHolders(c *gin.Context) {
+	insName := c.Param("inscription")
+	limit, offset, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	holders, err := h.service.ListHolders(c.Request.Context(), insName, limit, offset)
+	if err != nil {
+		internalError(c, "ListHolders", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"inscription": insName,
+		"limit":       limit,
+		"offset":      offset,
+		"holders":     holders,
+	})
+}
+
+// GetInscriptionLeaderboard returns a page of the holder leaderboard of an
+// inscription. Pages are chained with the opaque cursor of the previous page,
+// which keeps ranking them at the height of the first page while blocks are
+// indexed.
+func (h Handler) GetInscriptionLeaderboard(c *gin.Context) {
+	insName := c.Param("inscription")
+	limit, _, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var cursor *inscription.Cursor
+	if v := c.Query("cursor"); v != "" {
+		after, err := inscription.ParseCursor(v)
+		if err != nil {
+			badRequest(c, "invalid cursor")
+			return
+		}
+		cursor = &after
+	}
+
+	holders, height, err := h.service.Leaderboard(c.Request.Context(), insName, cursor, limit)
+	if err != nil {
+		internalError(c, "Leaderboard", err)
+		return
+	}
+
+	next := ""
+	if len(holders) == limit {
+		last := holders[len(holders)-1]
+		next = inscription.Cursor{Height: height, Amount: last.Amount, Account: last.Account}.String()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"inscription": insName,
+		"height":      height,
+		"holders":     holders,
+		"next_cursor": next,
+	})
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"errors"
+	"flow-indexer/internal/domain"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNFTProvenance returns the mint, every transfer and the current owner of
+// an inscription NFT.
+func (h Handler) GetNFTProvenance(c *gin.Context) {
+	insName := c.Param("inscription")
+	nftID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		badRequest(c, "id must be a non-negative integer")
+		return
+	}
+
+	provenance, err := h.service.GetProvenance(c.Request.Context(), insName, nftID)
+	if errors.Is(err, domain.ErrNotFound) {
+		notFound(c, "nft not found")
+		return
+	}
+	if err != nil {
+		internalError(c, "GetProvenance", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, provenance)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"flow-indexer/internal/domain/account"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/pkg/api/middlewares"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	streamBuffer      = 256
+	replayPageSize    = 500
+	heartbeatInterval = 15 * time.Second
+)
+
+// StreamEvents streams newly indexed events as Server-Sent Events, filtered
+// by the address, inscription and event query parameters. The id of every
+// message is the chain position of its event; a client reconnecting with
+// Last-Event-ID first receives the stored events it missed, without balances.
+func (h Handler) StreamEvents(c *gin.Context) {
+	filter := flowEvent.ChangeFilter{
+		Account:     account.NormalizeAddress(c.Query("address")),
+		Inscription: c.Query("inscription"),
+		Event:       c.Query("event"),
+	}
+
+	var last *flowEvent.Position
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	if lastID != "" {
+		p, err := flowEvent.ParsePosition(lastID)
+		if err != nil {
+			badRequest(c, "invalid Last-Event-ID")
+			return
+		}
+		last = &p
+	}
+
+	// subscribe before replaying so that nothing committed in between is
+	// missed, the live changes the replay already sent are skipped by
+	// position
+	sub := h.hub.Subscribe(func(change *flowEvent.Change) bool {
+		return filter.Match(&change.FlowEvent)
+	}, streamBuffer)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	if last != nil {
+		for {
+			changes, err := h.service.ListChanges(ctx, filter, *last, replayPageSize)
+			if err != nil {
+				// the headers are sent, the client is told in the stream
+				// and resumes from its last event id
+				middlewares.GetLogger(c).Error("ListChanges", zap.Error(err))
+				writeError(c, "internal error")
+				return
+			}
+			for i := range changes {
+				if !writeChange(c, &changes[i]) {
+					return
+				}
+				p := changes[i].Position()
+				last = &p
+			}
+			if len(changes) < replayPageSize {
+				break
+			}
+		}
+	}
+
+	// only the changes buffered while replaying can have been sent already,
+	// the dedup ends with the first live change past the replay
+	replayed := last
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(c.Writer, ": ping\n\n")
+			if err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case change, ok := <-sub.C():
+			if !ok {
+				// dropped or shutting down, the client resumes from its
+				// last event id
+				return
+			}
+			if replayed != nil {
+				if !replayed.Less(change.Position()) {
+					continue
+				}
+				replayed = nil
+			}
+			if !writeChange(c, &change) {
+				return
+			}
+		}
+	}
+}
+
+// writeChange writes change as an SSE message and reports whether the client
+// is still there.
+func writeChange(c *gin.Context, change *flowEvent.Change) bool {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: change\ndata: %s\n\n", change.Position(), data)
+	if err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
+// writeError writes msg as an SSE error message, for errors met once the
+// stream has started.
+func writeError(c *gin.Context, msg string) {
+	data, err := json.Marshal(gin.H{"error": msg})
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", data)
+	if err != nil {
+		return
+	}
+	c.Writer.Flush()
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"encoding/json"
+	"flow-indexer/internal/domain/account"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/stream"
+	"flow-indexer/pkg/api/middlewares"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	maxWatchedAddresses = 100
+	wsBuffer            = 256
+	wsReadLimit         = 64 * 1024
+	wsWriteWait         = 10 * time.Second
+	wsPongWait          = 60 * time.Second
+	wsPingInterval      = wsPongWait * 9 / 10
+)
+
+// balance data is public, so connections from any origin are accepted.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsRequest is a message sent by the client.
+type wsRequest struct {
+	// Type is subscribe or unsubscribe.
+	Type      string   `json:"type"`
+	Addresses []string `json:"addresses"`
+}
+
+// wsMessage is a message sent to the client. Type is subscribed or error in
+// reply to a request, or balance for a balance change.
+type wsMessage struct {
+	Type      string   `json:"type"`
+	Addresses []string `json:"addresses,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	*wsBalance
+}
+
+type wsBalance struct {
+	Account       string `json:"account"`
+	Inscription   string `json:"inscription"`
+	NFTID         uint64 `json:"nft_id"`
+	Event         string `json:"event"`
+	Delta         int64  `json:"delta"`
+	Balance       *int64 `json:"balance,omitempty"`
+	Block         uint64 `json:"block"`
+	TransactionID string `json:"transaction_id"`
+	Position      string `json:"position"`
+}
+
+// watchSet is the set of addresses a connection is subscribed to.
+type watchSet struct {
+	mu        sync.Mutex
+	addresses map[string]struct{}
+}
+
+func (w *watchSet) has(address string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.addresses[address]
+	return ok
+}
+
+// update applies req to the set and returns the addresses watched afterwards.
+// A subscription that would exceed maxWatchedAddresses is refused as a whole.
+func (w *watchSet) update(req wsRequest) ([]string, string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch req.Type {
+	case "subscribe":
+		added := 0
+		for _, a := range req.Addresses {
+			if _, ok := w.addresses[account.NormalizeAddress(a)]; !ok {
+				added++
+			}
+		}
+		if len(w.addresses)+added > maxWatchedAddresses {
+			return nil, fmt.Sprintf("at most %d addresses can be watched per connection", maxWatchedAddresses)
+		}
+		for _, a := range req.Addresses {
+			w.addresses[account.NormalizeAddress(a)] = struct{}{}
+		}
+	case "unsubscribe":
+		for _, a := range req.Addresses {
+			delete(w.addresses, account.NormalizeAddress(a))
+		}
+	default:
+		return nil, "type must be subscribe or unsubscribe"
+	}
+
+	addresses := make([]string, 0, len(w.addresses))
+	for a := range w.addresses {
+		addresses = append(addresses, a)
+	}
+	sort.Strings(addresses)
+	return addresses, ""
+}
+
+// WatchBalances upgrades the request to a WebSocket that pushes the balance
+// changes of the addresses the client subscribes to. A client falling too far
+// behind is disconnected with close code 1013.
+func (h Handler) WatchBalances(c *gin.Context) {
+	logger := middlewares.GetLogger(c)
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already replied
+		logger.Warn("websocket upgrade", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	watched := &watchSet{addresses: make(map[string]struct{})}
+	sub := h.hub.Subscribe(func(change *flowEvent.Change) bool {
+		return watched.has(change.Account)
+	}, wsBuffer)
+	defer sub.Close()
+
+	replies := make(chan wsMessage)
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(readerDone)
+		readRequests(conn, watched, replies, done)
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-readerDone:
+			return
+		case reply := <-replies:
+			if writeMessage(conn, reply) != nil {
+				return
+			}
+		case change, ok := <-sub.C():
+			if !ok {
+				if sub.Err() == stream.ErrSlowConsumer {
+					writeClose(conn, websocket.CloseTryAgainLater, "slow consumer")
+				} else {
+					writeClose(conn, websocket.CloseGoingAway, "shutting down")
+				}
+				return
+			}
+			if writeMessage(conn, newBalanceMessage(&change)) != nil {
+				return
+			}
+		case <-ping.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readRequests applies the requests of the client to watched until the
+// connection fails, sending a reply to every request.
+func readRequests(conn *websocket.Conn, watched *watchSet, replies chan<- wsMessage, done <-chan struct{}) {
+	conn.SetReadLimit(wsReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req wsRequest
+		err = json.Unmarshal(data, &req)
+		if err != nil {
+			// answered as an unknown request type
+			req = wsRequest{}
+		}
+
+		reply := wsMessage{Type: "subscribed"}
+		reply.Addresses, reply.Error = watched.update(req)
+		if reply.Error != "" {
+			reply.Type = "error"
+		}
+		select {
+		case replies <- reply:
+		case <-done:
+			return
+		}
+	}
+}
+
+func newBalanceMessage(change *flowEvent.Change) wsMessage {
+	return wsMessage{
+		Type: "balance",
+		wsBalance: &wsBalance{
+			Account:       change.Account,
+			Inscription:   change.Inscription,
+			NFTID:         change.NFTID,
+			Event:         change.Event,
+			Delta:         change.Delta(),
+			Balance:       change.Balance,
+			Block:         change.Block,
+			TransactionID: change.TransactionID,
+			Position:      change.Position().String(),
+		},
+	}
+}
+
+func writeMessage(conn *websocket.Conn, msg wsMessage) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(msg)
+}
+
+func writeClose(conn *websocket.Conn, code int, text string) {
+	msg := websocket.FormatCloseMessage(code, text)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+}
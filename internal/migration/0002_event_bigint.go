@@ -0,0 +1,189 @@
+package migration
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// eventTable is the events table as of migration 0002.
+const eventTable = domain.FlowInscriptionPrefix + "event"
+
+// backfillBatch is the number of rows copied per statement by the online
+// migrations, small enough to keep the row locks short.
+const backfillBatch = 10000
+
+// swapLockTimeout bounds the wait for the exclusive lock of a table, so that
+// a migration fails instead of queueing every query behind it. It can be run
+// again.
+const swapLockTimeout = "5s"
+
+// eventBigintIndexes are the indexes of the events table on block or nft_id,
+// rebuilt on the bigint columns.
+var eventBigintIndexes = []struct {
+	name    string
+	columns string
+}{
+	{"idx_flow_event_nft", "inscription, nft_id_new"},
+	{"idx_flow_event_inscription_block", "inscription, block_new"},
+	{"idx_flow_event_account_position", "account, block_new, transaction_index, event_index"},
+	{"idx_flow_event_position", "block_new, transaction_index, event_index"},
+}
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "event_bigint",
+		Up:      upEventBigint,
+		Down:    downEventBigint,
+	})
+}
+
+// upEventBigint moves the block and nft_id columns of the events from integer
+// to bigint. ALTER COLUMN TYPE would rewrite the table under an exclusive
+// lock, so bigint copies are added instead, kept in sync by a trigger,
+// backfilled in batches and indexed concurrently. Only the final swap takes
+// the lock, and it doesn't scan the table.
+func upEventBigint(ctx context.Context, x Executor) error {
+	var dataType []string
+	err := x.Scan(ctx, &dataType,
+		"SELECT data_type FROM information_schema.columns "+
+			"WHERE table_schema = current_schema() AND table_name = ? AND column_name = 'block'",
+		eventTable,
+	)
+	if err != nil {
+		return err
+	}
+	if len(dataType) > 0 && dataType[0] == "bigint" {
+		return nil
+	}
+
+	_, err = x.Exec(ctx, `ALTER TABLE "`+eventTable+`" `+
+		`ADD COLUMN IF NOT EXISTS block_new bigint, ADD COLUMN IF NOT EXISTS nft_id_new bigint`)
+	if err != nil {
+		return err
+	}
+	_, err = x.Exec(ctx, `CREATE OR REPLACE FUNCTION `+eventTable+`_bigint() RETURNS trigger AS $$
+BEGIN
+	NEW.block_new := NEW.block;
+	NEW.nft_id_new := NEW.nft_id;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`)
+	if err != nil {
+		return err
+	}
+	_, err = x.Exec(ctx, `DROP TRIGGER IF EXISTS `+eventTable+`_bigint ON "`+eventTable+`"; `+
+		`CREATE TRIGGER `+eventTable+`_bigint BEFORE INSERT OR UPDATE ON "`+eventTable+`" `+
+		`FOR EACH ROW EXECUTE FUNCTION `+eventTable+`_bigint()`)
+	if err != nil {
+		return err
+	}
+
+	err = backfillEventBigint(ctx, x)
+	if err != nil {
+		return fmt.Errorf("backfill: %w", err)
+	}
+
+	for _, idx := range eventBigintIndexes {
+		name := idx.name + "_new"
+		err = createIndex(ctx, x, zap.L(), name,
+			fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS "%s" ON "%s" (%s)`, name, eventTable, idx.columns))
+		if err != nil {
+			return fmt.Errorf("index %s: %w", name, err)
+		}
+	}
+
+	// the statements are sent together, so they run in a single transaction
+	// that releases the lock when it ends. Dropping the old columns drops
+	// their indexes.
+	swap := `SET LOCAL lock_timeout = '` + swapLockTimeout + `'; ` +
+		`LOCK TABLE "` + eventTable + `" IN ACCESS EXCLUSIVE MODE; ` +
+		`DROP TRIGGER ` + eventTable + `_bigint ON "` + eventTable + `"; ` +
+		`DROP FUNCTION ` + eventTable + `_bigint(); ` +
+		`ALTER TABLE "` + eventTable + `" DROP COLUMN block, DROP COLUMN nft_id; ` +
+		`ALTER TABLE "` + eventTable + `" RENAME COLUMN block_new TO block; ` +
+		`ALTER TABLE "` + eventTable + `" RENAME COLUMN nft_id_new TO nft_id; ` +
+		`ALTER TABLE "` + eventTable + `" ALTER COLUMN block SET DEFAULT 0, ALTER COLUMN nft_id SET DEFAULT 0; `
+	for _, idx := range eventBigintIndexes {
+		swap += `ALTER INDEX "` + idx.name + `_new" RENAME TO "` + idx.name + `"; `
+	}
+	_, err = x.Exec(ctx, swap)
+	if err != nil {
+		return fmt.Errorf("swap columns: %w", err)
+	}
+	return nil
+}
+
+// backfillEventBigint copies block and nft_id to their bigint columns in
+// batches of about backfillBatch rows, walking the events by block. A dry run
+// prints the batch statement once, with its bounds as placeholders, instead
+// of walking the table.
+func backfillEventBigint(ctx context.Context, x Executor) error {
+	update := `UPDATE "` + eventTable + `" SET block_new = block, nft_id_new = nft_id WHERE block_new IS NULL AND block >= ?`
+
+	if x.DryRun() {
+		_, err := x.Exec(ctx, update+" AND block < ?")
+		if err != nil {
+			return err
+		}
+		return backfillRest(ctx, x)
+	}
+
+	var first []int64
+	err := x.Scan(ctx, &first, `SELECT block FROM "`+eventTable+`" WHERE block IS NOT NULL ORDER BY block LIMIT 1`)
+	if err != nil {
+		return err
+	}
+	if len(first) > 0 {
+		from := first[0]
+		for {
+			var next []int64
+			err = x.Scan(ctx, &next,
+				`SELECT block FROM "`+eventTable+`" WHERE block >= ? ORDER BY block OFFSET ? LIMIT 1`,
+				from, backfillBatch,
+			)
+			if err != nil {
+				return err
+			}
+			if len(next) == 0 {
+				_, err = x.Exec(ctx, update, from)
+				if err != nil {
+					return err
+				}
+				break
+			}
+
+			// a block with more events than a batch is copied at once
+			to := next[0]
+			if to == from {
+				to++
+			}
+			_, err = x.Exec(ctx, update+" AND block < ?", from, to)
+			if err != nil {
+				return err
+			}
+			zap.L().Info("backfill events", zap.Int64("block", to))
+			from = to
+		}
+	}
+
+	return backfillRest(ctx, x)
+}
+
+// backfillRest copies the rows without a block, and any the batches missed.
+func backfillRest(ctx context.Context, x Executor) error {
+	_, err := x.Exec(ctx, `UPDATE "`+eventTable+`" SET block_new = block, nft_id_new = nft_id `+
+		`WHERE block_new IS DISTINCT FROM block OR nft_id_new IS DISTINCT FROM nft_id`)
+	return err
+}
+
+// downEventBigint moves block and nft_id back to integer. It rewrites the
+// table under an exclusive lock, and fails if a value doesn't fit.
+func downEventBigint(ctx context.Context, x Executor) error {
+	_, err := x.Exec(ctx, `ALTER TABLE "`+eventTable+`" `+
+		`ALTER COLUMN block TYPE integer, ALTER COLUMN nft_id TYPE integer`)
+	return err
+}
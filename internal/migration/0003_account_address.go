@@ -0,0 +1,180 @@
+package migration
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	accountTable     = domain.FlowInscriptionPrefix + "account"
+	balanceTable     = domain.FlowInscriptionPrefix + "balance"
+	snapshotTable    = domain.FlowInscriptionPrefix + "snapshot"
+	anomalyTable     = domain.FlowInscriptionPrefix + "anomaly"
+	nftTable         = domain.FlowInscriptionPrefix + "nft"
+	transferTable    = domain.FlowInscriptionPrefix + "transfer"
+	addressCheckName = "chk_" + accountTable + "_address"
+)
+
+// validAddress matches the addresses in the form account.NormalizeAddress
+// returns them, or empty for events without an address.
+const validAddress = `'^([0-9a-f]{16})?$'`
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "account_address",
+		Up:      upAccountAddress,
+		DownSQL: `ALTER TABLE "` + accountTable + `" DROP CONSTRAINT IF EXISTS "` + addressCheckName + `";
+ALTER TABLE "` + accountTable + `" ALTER COLUMN address TYPE varchar(42);`,
+	})
+}
+
+// upAccountAddress rewrites the addresses to the form account.NormalizeAddress
+// returns, lower case hex padded to 16 characters without 0x, and narrows the
+// accounts to it. Rows of an account stored under several spellings are
+// merged. The foreign keys to the accounts are dropped while the addresses
+// change, Migrator.Up adds them back once the migrations are done.
+func upAccountAddress(ctx context.Context, x Executor) error {
+	var done []string
+	err := x.Scan(ctx, &done,
+		"SELECT conname FROM pg_constraint WHERE conname = ? AND conrelid = to_regclass(?)",
+		addressCheckName, accountTable,
+	)
+	if err != nil {
+		return err
+	}
+	if len(done) > 0 {
+		return nil
+	}
+
+	_, err = x.Exec(ctx, `SET LOCAL lock_timeout = '`+swapLockTimeout+`'; `+
+		fmt.Sprintf(`ALTER TABLE "%s" DROP CONSTRAINT IF EXISTS "%s"; `,
+			eventTable, foreignKeyName(eventTable, domain.ForeignKeyConstraint{Field: "account"}))+
+		fmt.Sprintf(`ALTER TABLE "%s" DROP CONSTRAINT IF EXISTS "%s"`,
+			balanceTable, foreignKeyName(balanceTable, domain.ForeignKeyConstraint{Field: "account"})))
+	if err != nil {
+		return fmt.Errorf("drop foreign keys: %w", err)
+	}
+
+	for _, c := range []struct{ table, column string }{
+		{eventTable, "account"},
+		{anomalyTable, "account"},
+		{nftTable, "owner"},
+		{transferTable, "from_account"},
+		{transferTable, "to_account"},
+	} {
+		zap.L().Info("normalize addresses", zap.String("table", c.table), zap.String("column", c.column))
+		err = untilDone(ctx, x, fmt.Sprintf(`UPDATE "%s" SET %s = %s WHERE %s`,
+			c.table, c.column, normalizedAddress(c.column), batchOfMalformed(c.table, c.column)))
+		if err != nil {
+			return fmt.Errorf("normalize %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	// accounts, balances and snapshots are unique per address, their rows
+	// are moved to the normalized address and merged with the one there
+	for _, m := range []struct {
+		table, column string
+		// key holds the other columns of the unique key, sum the columns
+		// added up on merge and min those keeping their least value
+		key, sum, min []string
+	}{
+		{accountTable, "address", nil, nil, nil},
+		{balanceTable, "account", []string{"inscription"}, []string{"amount"}, []string{"first_seen_height"}},
+		{snapshotTable, "account", []string{"inscription", "height"}, []string{"amount"}, nil},
+	} {
+		zap.L().Info("normalize addresses", zap.String("table", m.table), zap.String("column", m.column))
+		err = untilDone(ctx, x, mergeAddressSQL(m.table, m.column, m.key, m.sum, m.min))
+		if err != nil {
+			return fmt.Errorf("normalize %s.%s: %w", m.table, m.column, err)
+		}
+	}
+
+	var invalid []string
+	err = x.Scan(ctx, &invalid, fmt.Sprintf(`SELECT address FROM "%s" WHERE address !~ %s AND NOT (%s) LIMIT 10`,
+		accountTable, validAddress, fixableAddress("address")))
+	if err != nil {
+		return err
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("accounts %q are not Flow addresses, delete them and migrate again", invalid)
+	}
+
+	// the accounts are few next to the events, the table is rewritten under
+	// the lock
+	_, err = x.Exec(ctx, `SET LOCAL lock_timeout = '`+swapLockTimeout+`'; `+
+		fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN address TYPE varchar(16), ADD CONSTRAINT "%s" CHECK (address ~ %s)`,
+			accountTable, addressCheckName, validAddress))
+	if err != nil {
+		return fmt.Errorf("narrow addresses: %w", err)
+	}
+	return nil
+}
+
+// mergeAddressSQL is the batch statement moving the rows of table with a
+// malformed address in column to the normalized address. key are the other
+// columns of its unique key. Of the rows meeting on the same key, the sum
+// columns are added up and the min columns keep their least value.
+func mergeAddressSQL(table, column string, key, sum, min []string) string {
+	key = append(append([]string{}, key...), column)
+	moved := append(append([]string{}, key[:len(key)-1]...), normalizedAddress(column)+" AS "+column)
+	selected := append([]string{}, key...)
+	var set []string
+	for _, c := range sum {
+		moved = append(moved, c)
+		selected = append(selected, "sum("+c+")")
+		set = append(set, c+" = t."+c+" + EXCLUDED."+c)
+	}
+	for _, c := range min {
+		moved = append(moved, c)
+		selected = append(selected, "min("+c+")")
+		set = append(set, c+" = LEAST(t."+c+", EXCLUDED."+c+")")
+	}
+	set = append(set, "updated_at = EXCLUDED.updated_at")
+	columns := append(append(append([]string{}, key...), sum...), min...)
+
+	return fmt.Sprintf(`WITH moved AS (
+	DELETE FROM "%s" WHERE %s
+	RETURNING %s, created_at
+)
+INSERT INTO "%s" AS t (%s, created_at, updated_at)
+SELECT %s, min(created_at), now() FROM moved GROUP BY %s
+ON CONFLICT (%s) DO UPDATE SET %s`,
+		table, batchOfMalformed(table, column),
+		strings.Join(moved, ", "),
+		table, strings.Join(columns, ", "),
+		strings.Join(selected, ", "), strings.Join(key, ", "),
+		strings.Join(key, ", "), strings.Join(set, ", "))
+}
+
+// normalizedAddress is the SQL of account.NormalizeAddress applied to column.
+func normalizedAddress(column string) string {
+	return fmt.Sprintf(`lpad(lower(regexp_replace(%s, '^0x', '', 'i')), 16, '0')`, column)
+}
+
+// fixableAddress is the SQL condition of column holding a Flow address,
+// normalized or not.
+func fixableAddress(column string) string {
+	return fmt.Sprintf(`lower(regexp_replace(%s, '^0x', '', 'i')) ~ '^[0-9a-f]{1,16}$'`, column)
+}
+
+// batchOfMalformed is the SQL condition selecting up to backfillBatch rows of
+// table whose column holds a Flow address not in its normalized form.
+func batchOfMalformed(table, column string) string {
+	return fmt.Sprintf(`ctid = ANY(ARRAY(SELECT ctid FROM "%s" WHERE %s !~ %s AND %s LIMIT %d))`,
+		table, column, validAddress, fixableAddress(column), backfillBatch)
+}
+
+// untilDone runs the batch statement sql until it affects no rows.
+func untilDone(ctx context.Context, x Executor, sql string) error {
+	for {
+		n, err := x.Exec(ctx, sql)
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
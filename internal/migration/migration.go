@@ -0,0 +1,136 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// Migration is a versioned change of the schema. SQL migrations run in a
+// single transaction. Go migrations run outside of one so that they can work
+// in batches, and must be safe to run again after a failure.
+type Migration struct {
+	Version int
+	Name    string
+
+	UpSQL   string
+	DownSQL string
+
+	Up   func(ctx context.Context, x Executor) error
+	Down func(ctx context.Context, x Executor) error
+}
+
+// Executor runs the statements of a migration, or prints them on a dry run.
+type Executor interface {
+	// Exec runs sql and returns the number of rows it affected, always 0 on
+	// a dry run so that batch loops end after printing their first batch.
+	Exec(ctx context.Context, sql string, args ...interface{}) (int64, error)
+	// Scan runs the query sql into dest. Queries run on dry runs too, so
+	// they must only read.
+	Scan(ctx context.Context, dest interface{}, sql string, args ...interface{}) error
+	// DryRun reports whether the statements are printed instead of run.
+	DryRun() bool
+}
+
+// Checksum identifies the SQL of an SQL migration, applied migrations must
+// not change. It is empty for Go migrations.
+func (m Migration) Checksum() string {
+	if m.Up != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+var goMigrations []Migration
+
+// register adds a Go migration, from the init function of its file.
+func register(m Migration) {
+	goMigrations = append(goMigrations, m)
+}
+
+// All returns the embedded SQL migrations and the Go migrations by version.
+// SQL migrations are the files sql/<version>_<name>.up.sql and their
+// .down.sql counterparts.
+func All() ([]Migration, error) {
+	return load(sqlFiles, goMigrations)
+}
+
+// load returns the SQL migrations in the sql directory of fsys and the Go
+// migrations registered by version.
+func load(fsys fs.FS, registered []Migration) ([]Migration, error) {
+	byVersion := make(map[int]*Migration)
+	for i := range registered {
+		m := registered[i]
+		if byVersion[m.Version] != nil {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+		byVersion[m.Version] = &m
+	}
+
+	names, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sqlVersions := make(map[int]bool)
+	for _, name := range names {
+		base := path.Base(name)
+		stem, direction := strings.TrimSuffix(base, ".up.sql"), "up"
+		if strings.HasSuffix(base, ".down.sql") {
+			stem, direction = strings.TrimSuffix(base, ".down.sql"), "down"
+		} else if stem == base {
+			return nil, fmt.Errorf("%s: migration files end with .up.sql or .down.sql", base)
+		}
+		parts := strings.SplitN(stem, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("%s: migration files are named <version>_<name>", base)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+			sqlVersions[version] = true
+		}
+		if !sqlVersions[version] || m.Name != parts[1] {
+			return nil, fmt.Errorf("duplicate migration version %d", version)
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if direction == "up" {
+			m.UpSQL = string(data)
+		} else {
+			m.DownSQL = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil && m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %s has no up", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
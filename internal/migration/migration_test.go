@@ -0,0 +1,144 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func noop(context.Context, Executor) error { return nil }
+
+func TestAll(t *testing.T) {
+	migrations, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m, m.Version, i+1)
+		}
+		if m.Up == nil && m.DownSQL == "" {
+			t.Errorf("SQL migration %s has no .down.sql", m)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+	goMigration := Migration{Version: 2, Name: "go", Up: noop}
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "sql and go by version",
+			files: fstest.MapFS{
+				"sql/0003_third.up.sql":   file("CREATE 3"),
+				"sql/0003_third.down.sql": file("DROP 3"),
+				"sql/0001_first.up.sql":   file("CREATE 1"),
+			},
+			want: []string{"0001_first", "0002_go", "0003_third"},
+		},
+		{
+			name:    "unknown suffix",
+			files:   fstest.MapFS{"sql/0001_first.sql": file("CREATE 1")},
+			wantErr: "end with .up.sql or .down.sql",
+		},
+		{
+			name:    "no version",
+			files:   fstest.MapFS{"sql/first.up.sql": file("CREATE 1")},
+			wantErr: "named <version>_<name>",
+		},
+		{
+			name:    "no name",
+			files:   fstest.MapFS{"sql/0001.up.sql": file("CREATE 1")},
+			wantErr: "named <version>_<name>",
+		},
+		{
+			name:    "version of a go migration",
+			files:   fstest.MapFS{"sql/0002_go.up.sql": file("CREATE 2")},
+			wantErr: "duplicate migration version 2",
+		},
+		{
+			name: "version with two names",
+			files: fstest.MapFS{
+				"sql/0001_first.up.sql": file("CREATE 1"),
+				"sql/0001_other.up.sql": file("CREATE 1"),
+			},
+			wantErr: "duplicate migration version 1",
+		},
+		{
+			name:    "down without up",
+			files:   fstest.MapFS{"sql/0001_first.down.sql": file("DROP 1")},
+			wantErr: "0001_first has no up",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := load(tt.files, []Migration{goMigration})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, m := range migrations {
+				got = append(got, m.String())
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPairsFiles(t *testing.T) {
+	migrations, err := load(fstest.MapFS{
+		"sql/0001_first.up.sql":   {Data: []byte("CREATE 1")},
+		"sql/0001_first.down.sql": {Data: []byte("DROP 1")},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 1 {
+		t.Fatalf("load() returned %d migrations, want 1", len(migrations))
+	}
+	if m := migrations[0]; m.UpSQL != "CREATE 1" || m.DownSQL != "DROP 1" {
+		t.Errorf("load() = %+v, want the up and down of 0001_first", m)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("CREATE 1"))
+	m := Migration{Version: 1, Name: "first", UpSQL: "CREATE 1", DownSQL: "DROP 1"}
+	if got, want := m.Checksum(), hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("Checksum() = %s, want %s", got, want)
+	}
+
+	down := m
+	down.DownSQL = "DROP 1 CASCADE"
+	if down.Checksum() != m.Checksum() {
+		t.Error("Checksum() changed with the down SQL")
+	}
+
+	up := m
+	up.UpSQL = "CREATE 1 IF NOT EXISTS"
+	if up.Checksum() == m.Checksum() {
+		t.Error("Checksum() didn't change with the up SQL")
+	}
+
+	if got := (Migration{Version: 2, Name: "go", Up: noop}).Checksum(); got != "" {
+		t.Errorf("Checksum() of a Go migration = %q, want empty", got)
+	}
+}
@@ -0,0 +1,311 @@
+package migration
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Table records the applied migrations.
+const Table = domain.FlowInscriptionPrefix + "schema_migration"
+
+// lockKey identifies the advisory lock held while migrating, so that
+// instances starting together migrate one after the other.
+const lockKey = int64(0x666c6f77_6d696772) // "flowmigr"
+
+// record is a row of Table.
+type record struct {
+	Version   int       `gorm:"column:version"`
+	Name      string    `gorm:"column:name"`
+	Checksum  string    `gorm:"column:checksum"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+// State is a migration and when it was applied, nil if it is pending.
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and reverts the migrations, then creates the indexes and
+// foreign keys declared by models.
+type Migrator struct {
+	db         *gorm.DB
+	logger     *zap.Logger
+	migrations []Migration
+	models     []interface{}
+	dryRun     io.Writer
+}
+
+// New returns a Migrator of the embedded migrations and the domain models.
+// If dryRun is not nil the statements are written to it instead of being
+// run.
+func New(db *gorm.DB, logger *zap.Logger, dryRun io.Writer) (*Migrator, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		logger:     logger,
+		migrations: migrations,
+		models:     Models(),
+		dryRun:     dryRun,
+	}, nil
+}
+
+// Up applies the pending migrations in order, then syncs the constraints
+// and indexes declared by the models.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(ctx, conn, true)
+		if err != nil {
+			return err
+		}
+
+		latest := 0
+		for _, r := range applied {
+			if r.Version > latest {
+				latest = r.Version
+			}
+		}
+		for _, mig := range m.migrations {
+			r, ok := applied[mig.Version]
+			if ok {
+				if r.Checksum != mig.Checksum() {
+					return fmt.Errorf("migration %s was changed after it was applied, add a new migration instead", mig)
+				}
+				continue
+			}
+			if mig.Version < latest {
+				return fmt.Errorf("migration %s is older than the applied migration %d", mig, latest)
+			}
+
+			err = m.apply(ctx, conn, mig, true)
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", mig, err)
+			}
+		}
+
+		return m.sync(ctx, conn)
+	})
+}
+
+// Down reverts the last steps applied migrations, latest first.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(ctx, conn, true)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, v := range versions {
+			mig, ok := m.find(v)
+			if !ok {
+				return fmt.Errorf("applied migration %d is unknown to this binary", v)
+			}
+			if mig.Down == nil && mig.DownSQL == "" {
+				return fmt.Errorf("migration %s cannot be reverted", mig)
+			}
+			err = m.apply(ctx, conn, mig, false)
+			if err != nil {
+				return fmt.Errorf("revert migration %s: %w", mig, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns every migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	applied, err := m.applied(ctx, m.db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, len(m.migrations))
+	for i, mig := range m.migrations {
+		states[i].Migration = mig
+		if r, ok := applied[mig.Version]; ok {
+			at := r.AppliedAt
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// locked runs fn on a single connection holding the migration lock. Dry runs
+// don't change anything so they don't take the lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	if m.dryRun != nil {
+		return fn(m.db.WithContext(ctx))
+	}
+
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		var locked bool
+		err := conn.Raw("SELECT pg_try_advisory_lock(?)", lockKey).Scan(&locked).Error
+		if err != nil {
+			return fmt.Errorf("lock: %w", err)
+		}
+		if !locked {
+			m.logger.Info("waiting for another instance to migrate")
+			err = conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error
+			if err != nil {
+				return fmt.Errorf("lock: %w", err)
+			}
+		}
+		defer func() {
+			// the connection goes back to the pool, release the lock even
+			// if ctx is done
+			err := conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?)", lockKey).Error
+			if err != nil {
+				m.logger.Error("unlock", zap.Error(err))
+			}
+		}()
+
+		return fn(conn)
+	})
+}
+
+// applied returns the applied migrations by version. Table is created if it
+// is missing and create is set.
+func (m *Migrator) applied(ctx context.Context, conn *gorm.DB, create bool) (map[int]record, error) {
+	var exists bool
+	err := conn.WithContext(ctx).Raw("SELECT to_regclass(?) IS NOT NULL", Table).Scan(&exists).Error
+	if err != nil {
+		return nil, err
+	}
+	if !exists && !create {
+		return map[int]record{}, nil
+	}
+	if !exists {
+		_, err = m.executor(conn).Exec(ctx, "CREATE TABLE IF NOT EXISTS "+Table+" ("+
+			"version bigint PRIMARY KEY, "+
+			"name varchar(256) NOT NULL, "+
+			"checksum varchar(64) NOT NULL DEFAULT '', "+
+			"applied_at timestamp with time zone NOT NULL DEFAULT now())")
+		if err != nil {
+			return nil, fmt.Errorf("create %s: %w", Table, err)
+		}
+		return map[int]record{}, nil
+	}
+
+	var records []record
+	err = conn.WithContext(ctx).Table(Table).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// apply runs mig up or down and records it.
+func (m *Migrator) apply(ctx context.Context, conn *gorm.DB, mig Migration, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	m.logger.Info("migrate", zap.String("migration", mig.String()), zap.String("direction", direction))
+	if m.dryRun != nil {
+		fmt.Fprintf(m.dryRun, "-- %s %s\n", mig, direction)
+	}
+
+	record := func(x Executor) error {
+		var err error
+		if up {
+			_, err = x.Exec(ctx, "INSERT INTO "+Table+" (version, name, checksum) VALUES (?, ?, ?)",
+				mig.Version, mig.Name, mig.Checksum())
+		} else {
+			_, err = x.Exec(ctx, "DELETE FROM "+Table+" WHERE version = ?", mig.Version)
+		}
+		return err
+	}
+
+	run, sql := mig.Down, mig.DownSQL
+	if up {
+		run, sql = mig.Up, mig.UpSQL
+	}
+	if run != nil {
+		err := run(ctx, m.executor(conn))
+		if err != nil {
+			return err
+		}
+		return record(m.executor(conn))
+	}
+
+	if m.dryRun != nil {
+		fmt.Fprintln(m.dryRun, strings.TrimSpace(sql))
+		return record(m.executor(conn))
+	}
+	return conn.Transaction(func(tx *gorm.DB) error {
+		x := m.executor(tx)
+		_, err := x.Exec(ctx, sql)
+		if err != nil {
+			return err
+		}
+		return record(x)
+	})
+}
+
+func (m *Migrator) executor(db *gorm.DB) Executor {
+	return executor{db: db, dryRun: m.dryRun}
+}
+
+type executor struct {
+	db     *gorm.DB
+	dryRun io.Writer
+}
+
+func (x executor) Exec(ctx context.Context, sql string, args ...interface{}) (int64, error) {
+	if x.dryRun != nil {
+		stmt := x.db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return tx.Exec(sql, args...)
+		})
+		_, err := fmt.Fprintf(x.dryRun, "%s;\n", stmt)
+		return 0, err
+	}
+
+	// statements without arguments are sent with the simple protocol, so an
+	// SQL migration can hold several of them
+	res := x.db.WithContext(ctx).Exec(sql, args...)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
+
+func (x executor) Scan(ctx context.Context, dest interface{}, sql string, args ...interface{}) error {
+	return x.db.WithContext(ctx).Raw(sql, args...).Scan(dest).Error
+}
+
+func (x executor) DryRun() bool {
+	return x.dryRun != nil
+}
@@ -0,0 +1,10 @@
+-- The uuid-ossp extension is left in place, other schemas may use it.
+DROP TABLE IF EXISTS "flow_inscription_transfer";
+DROP TABLE IF EXISTS "flow_inscription_nft";
+DROP TABLE IF EXISTS "flow_inscription_snapshot_height";
+DROP TABLE IF EXISTS "flow_inscription_snapshot";
+DROP TABLE IF EXISTS "flow_inscription_anomaly";
+DROP TABLE IF EXISTS "flow_inscription_checkpoint";
+DROP TABLE IF EXISTS "flow_inscription_event";
+DROP TABLE IF EXISTS "flow_inscription_balance";
+DROP TABLE IF EXISTS "flow_inscription_account";
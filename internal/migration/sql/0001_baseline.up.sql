@@ -0,0 +1,164 @@
+-- The schema as last created by AutoMigrate. Every statement is guarded so
+-- that databases created by AutoMigrate adopt the migrations unchanged.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_account" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"address" varchar(42),
+	PRIMARY KEY ("address")
+);
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_balance" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"id" uuid DEFAULT uuid_generate_v4(),
+	"account" text,
+	"inscription" varchar(256),
+	"amount" bigint DEFAULT 0,
+	"first_seen_height" bigint DEFAULT 0,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_balance_inscription" ON "flow_inscription_balance" ("inscription");
+CREATE INDEX IF NOT EXISTS "idx_balance_leaderboard" ON "flow_inscription_balance" ("inscription", "amount" DESC, "account");
+-- Older versions could create a balance twice in a FirstOrCreate race, the
+-- copies are merged into the oldest one before the unique index is built.
+WITH ranked AS (
+	SELECT id,
+		row_number() OVER (PARTITION BY account, inscription ORDER BY created_at, id) AS n,
+		sum(amount) OVER (PARTITION BY account, inscription) AS total
+	FROM "flow_inscription_balance"
+	WHERE (account, inscription) IN (
+		SELECT account, inscription FROM "flow_inscription_balance"
+		GROUP BY account, inscription HAVING count(*) > 1
+	)
+), merged AS (
+	UPDATE "flow_inscription_balance" b SET amount = r.total, updated_at = now()
+	FROM ranked r WHERE b.id = r.id AND r.n = 1
+)
+DELETE FROM "flow_inscription_balance" b USING ranked r WHERE b.id = r.id AND r.n > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_balance_account_inscription" ON "flow_inscription_balance" ("account", "inscription");
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_balance_account" ON "flow_inscription_balance" ("account");
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_event" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"id" uuid DEFAULT uuid_generate_v4(),
+	"nft_id" integer DEFAULT 0,
+	"account" text,
+	"inscription" varchar(256) DEFAULT 'freeflow',
+	"event" varchar(256),
+	"block" integer DEFAULT 0,
+	"transaction_id" varchar(64) DEFAULT '',
+	"transaction_index" integer DEFAULT 0,
+	"event_index" integer DEFAULT 0,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_flow_event_nft" ON "flow_inscription_event" ("inscription", "nft_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_flow_event_identity" ON "flow_inscription_event" ("transaction_id", "transaction_index", "event_index") WHERE transaction_id <> '';
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_event_event" ON "flow_inscription_event" ("event");
+CREATE INDEX IF NOT EXISTS "idx_flow_event_inscription_block" ON "flow_inscription_event" ("inscription", "block");
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_event_inscription" ON "flow_inscription_event" ("inscription");
+CREATE INDEX IF NOT EXISTS "idx_flow_event_account_position" ON "flow_inscription_event" ("account", "block", "transaction_index", "event_index");
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_event_account" ON "flow_inscription_event" ("account");
+
+-- Balances written before first_seen_height was added get the block of
+-- their first event.
+ALTER TABLE "flow_inscription_balance" ADD COLUMN IF NOT EXISTS "first_seen_height" bigint DEFAULT 0;
+UPDATE "flow_inscription_balance" b SET first_seen_height = e.block
+FROM (
+	SELECT account, inscription, MIN(block) AS block FROM "flow_inscription_event"
+	GROUP BY account, inscription
+) e
+WHERE e.account = b.account AND e.inscription = b.inscription AND b.first_seen_height = 0;
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_checkpoint" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"event_type" varchar(256),
+	"start_block" bigint,
+	"end_block" bigint,
+	"height" bigint DEFAULT 0,
+	PRIMARY KEY ("event_type", "start_block", "end_block")
+);
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_anomaly" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"id" uuid DEFAULT uuid_generate_v4(),
+	"inscription" varchar(256),
+	"account" text,
+	"event" varchar(256),
+	"nft_id" bigint DEFAULT 0,
+	"block" bigint DEFAULT 0,
+	"transaction_id" varchar(64) DEFAULT '',
+	"transaction_index" integer DEFAULT 0,
+	"event_index" integer DEFAULT 0,
+	"amount" bigint DEFAULT 0,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_anomaly_account" ON "flow_inscription_anomaly" ("account");
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_anomaly_inscription" ON "flow_inscription_anomaly" ("inscription");
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_snapshot" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"inscription" varchar(256),
+	"height" bigint,
+	"account" text,
+	"amount" bigint DEFAULT 0,
+	PRIMARY KEY ("inscription", "height", "account")
+);
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_snapshot_height" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"height" bigint,
+	PRIMARY KEY ("height")
+);
+-- Snapshots taken before their heights were recorded.
+INSERT INTO "flow_inscription_snapshot_height" (height, created_at, updated_at)
+SELECT DISTINCT height, now(), now() FROM "flow_inscription_snapshot"
+ON CONFLICT (height) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_nft" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"inscription" varchar(256),
+	"nft_id" bigint,
+	"owner" text,
+	"acquired_height" bigint DEFAULT 0,
+	"last_transfer_tx" varchar(64) DEFAULT '',
+	PRIMARY KEY ("inscription", "nft_id")
+);
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_nft_owner" ON "flow_inscription_nft" ("owner");
+
+CREATE TABLE IF NOT EXISTS "flow_inscription_transfer" (
+	"updated_at" timestamp with time zone,
+	"created_at" timestamp with time zone,
+	"id" uuid DEFAULT uuid_generate_v4(),
+	"inscription" varchar(256),
+	"nft_id" bigint DEFAULT 0,
+	"kind" varchar(16),
+	"from_account" text,
+	"to_account" text,
+	"block" bigint DEFAULT 0,
+	"transaction_id" varchar(64),
+	"transaction_index" integer DEFAULT 0,
+	"event_index" integer DEFAULT 0,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_transfer_to" ON "flow_inscription_transfer" ("to_account");
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_transfer_from" ON "flow_inscription_transfer" ("from_account");
+CREATE INDEX IF NOT EXISTS "idx_flow_inscription_transfer_kind" ON "flow_inscription_transfer" ("kind");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_transfer_identity" ON "flow_inscription_transfer" ("inscription", "nft_id", "transaction_id", "event_index");
+-- Transfers indexed before returns were told apart store every Deposit
+-- without a Withdraw in its transaction as a mint. Only the first Deposit of
+-- an NFT is, the later ones bring it back from escrow.
+UPDATE "flow_inscription_transfer" t SET kind = 'return', updated_at = now()
+WHERE t.kind = 'mint' AND EXISTS (
+	SELECT 1 FROM "flow_inscription_transfer" d
+	WHERE d.inscription = t.inscription AND d.nft_id = t.nft_id
+		AND d.kind NOT IN ('burn', 'escrow')
+		AND (d.block, d.transaction_index, d.event_index) < (t.block, t.transaction_index, t.event_index)
+);
@@ -0,0 +1,162 @@
+package migration
+
+import (
+	"context"
+	"flow-indexer/internal/domain"
+	"flow-indexer/internal/domain/account"
+	"flow-indexer/internal/domain/anomaly"
+	"flow-indexer/internal/domain/checkpoint"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/inscription"
+	"flow-indexer/internal/domain/nft"
+	"flow-indexer/internal/domain/snapshot"
+	"flow-indexer/internal/domain/transfer"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Models returns the domain models whose declared indexes and foreign keys
+// are created by Migrator.Up.
+func Models() []interface{} {
+	return []interface{}{
+		&account.Account{},
+		&inscription.Balance{},
+		&flowEvent.FlowEvent{},
+		&checkpoint.Checkpoint{},
+		&anomaly.Anomaly{},
+		&snapshot.Snapshot{},
+		&nft.Ownership{},
+		&transfer.Transfer{},
+	}
+}
+
+type tabler interface {
+	TableName() string
+}
+
+// sync creates the indexes of the domain.CustomIndexer models and the
+// foreign keys of the domain.ForeignKeyConstrainer ones that don't exist
+// yet. Indexes are built concurrently and foreign keys validated after they
+// are added, so that writes are not blocked while the tables are scanned.
+// Existing ones are identified by name, so changing a declaration needs a
+// new name.
+func (m *Migrator) sync(ctx context.Context, conn *gorm.DB) error {
+	x := m.executor(conn)
+	for _, model := range m.models {
+		table := model.(tabler).TableName()
+
+		if indexer, ok := model.(domain.CustomIndexer); ok {
+			for _, idx := range indexer.Indexes() {
+				err := m.syncIndex(ctx, x, table, idx)
+				if err != nil {
+					return fmt.Errorf("index %s: %w", idx.Name, err)
+				}
+			}
+		}
+
+		if constrainer, ok := model.(domain.ForeignKeyConstrainer); ok {
+			for _, fk := range constrainer.ForeignKeyConstraints() {
+				err := m.syncForeignKey(ctx, x, table, fk)
+				if err != nil {
+					return fmt.Errorf("foreign key %s: %w", foreignKeyName(table, fk), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) syncIndex(ctx context.Context, x Executor, table string, idx domain.CustomIndex) error {
+	return createIndex(ctx, x, m.logger, idx.Name, createIndexSQL(table, idx))
+}
+
+// createIndex runs sql, the CREATE INDEX CONCURRENTLY statement of the index
+// name, unless a valid index of that name exists.
+func createIndex(ctx context.Context, x Executor, logger *zap.Logger, name, sql string) error {
+	var valid []bool
+	err := x.Scan(ctx, &valid,
+		"SELECT i.indisvalid FROM pg_index i "+
+			"JOIN pg_class c ON c.oid = i.indexrelid "+
+			"JOIN pg_namespace n ON n.oid = c.relnamespace "+
+			"WHERE c.relname = ? AND n.nspname = current_schema()",
+		name,
+	)
+	if err != nil {
+		return err
+	}
+	if len(valid) > 0 && valid[0] {
+		return nil
+	}
+	if len(valid) > 0 {
+		// left behind by a failed concurrent build
+		logger.Warn("rebuild invalid index", zap.String("index", name))
+		_, err = x.Exec(ctx, `DROP INDEX CONCURRENTLY IF EXISTS "`+name+`"`)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("create index", zap.String("index", name))
+	_, err = x.Exec(ctx, sql)
+	return err
+}
+
+func createIndexSQL(table string, idx domain.CustomIndex) string {
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if idx.Unique {
+		b.WriteString("UNIQUE ")
+	}
+	fmt.Fprintf(&b, `INDEX CONCURRENTLY IF NOT EXISTS "%s" ON "%s"`, idx.Name, table)
+	if idx.Type != "" {
+		b.WriteString(" USING " + idx.Type)
+	}
+	b.WriteString(" (" + strings.Join(idx.Fields, ", ") + ")")
+	if idx.Condition != "" {
+		b.WriteString(" WHERE " + idx.Condition)
+	}
+	return b.String()
+}
+
+func (m *Migrator) syncForeignKey(ctx context.Context, x Executor, table string, fk domain.ForeignKeyConstraint) error {
+	name := foreignKeyName(table, fk)
+	var validated []bool
+	err := x.Scan(ctx, &validated,
+		"SELECT convalidated FROM pg_constraint WHERE conname = ? AND conrelid = to_regclass(?)",
+		name, table,
+	)
+	if err != nil {
+		return err
+	}
+	if len(validated) > 0 && validated[0] {
+		return nil
+	}
+
+	if len(validated) == 0 {
+		m.logger.Info("add foreign key", zap.String("constraint", name), zap.String("table", table))
+		// NOT VALID only checks the new rows, the existing ones are checked
+		// below without blocking writes
+		sql := fmt.Sprintf(`ALTER TABLE "%s" ADD CONSTRAINT "%s" FOREIGN KEY ("%s") REFERENCES %s`,
+			table, name, fk.Field, fk.Dest)
+		if fk.OnDelete != "" {
+			sql += " ON DELETE " + fk.OnDelete
+		}
+		if fk.OnUpdate != "" {
+			sql += " ON UPDATE " + fk.OnUpdate
+		}
+		_, err = x.Exec(ctx, sql+" NOT VALID")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = x.Exec(ctx, fmt.Sprintf(`ALTER TABLE "%s" VALIDATE CONSTRAINT "%s"`, table, name))
+	return err
+}
+
+func foreignKeyName(table string, fk domain.ForeignKeyConstraint) string {
+	return "fk_" + table + "_" + fk.Field
+}
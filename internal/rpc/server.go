@@ -0,0 +1,269 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"flow-indexer/internal/domain/account"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/inscription"
+	"flow-indexer/internal/service"
+	"flow-indexer/internal/stream"
+	"flow-indexer/pkg/api/pb"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultLimit   = 100
+	maxLimit       = 1000
+	streamBuffer   = 256
+	replayPageSize = 500
+)
+
+// Server implements the Indexer gRPC service on top of the same service layer
+// and change hub as the HTTP API.
+type Server struct {
+	pb.UnimplementedIndexerServer
+	service service.Service
+	hub     *stream.Hub
+}
+
+func NewServer(service service.Service, hub *stream.Hub) *Server {
+	return &Server{service: service, hub: hub}
+}
+
+// Register adds the Indexer service to g.
+func (s *Server) Register(g *grpc.Server) {
+	pb.RegisterIndexerServer(g, s)
+}
+
+func (s *Server) GetBalance(ctx context.Context, req *pb.GetBalanceRequest) (*pb.GetBalanceResponse, error) {
+	if req.Address == "" || req.Inscription == "" {
+		return nil, status.Error(codes.InvalidArgument, "address and inscription are required")
+	}
+	address := account.NormalizeAddress(req.Address)
+
+	var amount int64
+	if req.Height > 0 {
+		var err error
+		amount, err = s.service.BalanceAt(ctx, req.Inscription, address, req.Height)
+		if err != nil {
+			return nil, internalError("BalanceAt", err)
+		}
+	} else {
+		balances, err := s.service.ListBalances(ctx, address)
+		if err != nil {
+			return nil, internalError("ListBalances", err)
+		}
+		for _, b := range balances {
+			if b.Inscription == req.Inscription {
+				amount = b.Amount
+			}
+		}
+	}
+
+	return &pb.GetBalanceResponse{
+		Address:     address,
+		Inscription: req.Inscription,
+		Amount:      amount,
+	}, nil
+}
+
+func (s *Server) ListHolders(ctx context.Context, req *pb.ListHoldersRequest) (*pb.ListHoldersResponse, error) {
+	if req.Inscription == "" {
+		return nil, status.Error(codes.InvalidArgument, "inscription is required")
+	}
+	limit, err := pageLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor *inscription.Cursor
+	if req.Cursor != "" {
+		after, err := inscription.ParseCursor(req.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+		cursor = &after
+	}
+
+	holders, height, err := s.service.Leaderboard(ctx, req.Inscription, cursor, limit)
+	if err != nil {
+		return nil, internalError("Leaderboard", err)
+	}
+
+	resp := &pb.ListHoldersResponse{}
+	for _, h := range holders {
+		resp.Holders = append(resp.Holders, &pb.Holder{
+			Rank:            h.Rank,
+			Account:         h.Account,
+			Amount:          h.Amount,
+			Share:           h.Share,
+			FirstSeenHeight: h.FirstSeenHeight,
+		})
+	}
+	if len(holders) == limit {
+		last := holders[len(holders)-1]
+		resp.NextCursor = inscription.Cursor{Height: height, Amount: last.Amount, Account: last.Account}.String()
+	}
+	return resp, nil
+}
+
+func (s *Server) ListEvents(ctx context.Context, req *pb.ListEventsRequest) (*pb.ListEventsResponse, error) {
+	if req.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "address is required")
+	}
+	limit, err := pageLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := flowEvent.ActivityFilter{
+		Inscription: req.Inscription,
+		Event:       req.Event,
+		FromHeight:  req.FromHeight,
+		ToHeight:    req.ToHeight,
+		Limit:       limit,
+	}
+	if req.Cursor != "" {
+		after, err := flowEvent.ParsePosition(req.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+		filter.After = &after
+	}
+
+	activities, err := s.service.ListActivity(ctx, account.NormalizeAddress(req.Address), filter)
+	if err != nil {
+		return nil, internalError("ListActivity", err)
+	}
+
+	resp := &pb.ListEventsResponse{}
+	for i := range activities {
+		e := newEvent(&activities[i].FlowEvent)
+		e.TransferKind = activities[i].TransferKind
+		e.Counterparty = activities[i].Counterparty
+		resp.Events = append(resp.Events, e)
+	}
+	if len(activities) == limit {
+		resp.NextCursor = activities[len(activities)-1].Position().String()
+	}
+	return resp, nil
+}
+
+// SubscribeEvents replays the stored events after req.After, if set, then
+// streams the changes published by the indexer. A subscriber falling too far
+// behind is ended with ResourceExhausted and should resume from its last
+// position.
+func (s *Server) SubscribeEvents(req *pb.SubscribeEventsRequest, srv pb.Indexer_SubscribeEventsServer) error {
+	filter := flowEvent.ChangeFilter{
+		Account:     account.NormalizeAddress(req.Address),
+		Inscription: req.Inscription,
+		Event:       req.Event,
+	}
+
+	var last *flowEvent.Position
+	if req.After != "" {
+		p, err := flowEvent.ParsePosition(req.After)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "invalid after")
+		}
+		last = &p
+	}
+
+	// subscribe before replaying so that nothing committed in between is
+	// missed, the live changes the replay already sent are skipped by
+	// position
+	sub := s.hub.Subscribe(func(change *flowEvent.Change) bool {
+		return filter.Match(&change.FlowEvent)
+	}, streamBuffer)
+	defer sub.Close()
+
+	ctx := srv.Context()
+	if last != nil {
+		for {
+			changes, err := s.service.ListChanges(ctx, filter, *last, replayPageSize)
+			if err != nil {
+				return internalError("ListChanges", err)
+			}
+			for i := range changes {
+				err = srv.Send(newChange(&changes[i]))
+				if err != nil {
+					return err
+				}
+				p := changes[i].Position()
+				last = &p
+			}
+			if len(changes) < replayPageSize {
+				break
+			}
+		}
+	}
+
+	// only the changes buffered while replaying can have been sent already,
+	// the dedup ends with the first live change past the replay
+	replayed := last
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change, ok := <-sub.C():
+			if !ok {
+				if errors.Is(sub.Err(), stream.ErrSlowConsumer) {
+					return status.Error(codes.ResourceExhausted, "slow consumer")
+				}
+				return status.Error(codes.Unavailable, "shutting down")
+			}
+			if replayed != nil {
+				if !replayed.Less(change.Position()) {
+					continue
+				}
+				replayed = nil
+			}
+			err := srv.Send(newChange(&change))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func newEvent(e *flowEvent.FlowEvent) *pb.Event {
+	return &pb.Event{
+		Account:          e.Account,
+		Inscription:      e.Inscription,
+		Event:            e.Event,
+		NftId:            e.NFTID,
+		Block:            e.Block,
+		TransactionId:    e.TransactionID,
+		TransactionIndex: uint32(e.TransactionIndex),
+		EventIndex:       uint32(e.EventIndex),
+	}
+}
+
+func newChange(change *flowEvent.Change) *pb.Change {
+	return &pb.Change{
+		Event:    newEvent(&change.FlowEvent),
+		Balance:  change.Balance,
+		Position: change.Position().String(),
+	}
+}
+
+func pageLimit(limit uint32) (int, error) {
+	if limit == 0 {
+		return defaultLimit, nil
+	}
+	if limit > maxLimit {
+		return 0, status.Errorf(codes.InvalidArgument, "limit must be at most %d", maxLimit)
+	}
+	return int(limit), nil
+}
+
+func internalError(msg string, err error) error {
+	zap.L().Error(msg, zap.Error(err))
+	return status.Error(codes.Internal, "internal error")
+}
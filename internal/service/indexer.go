@@ -2,70 +2,383 @@ package service
 
 import (
 	"context"
+	"flow-indexer/internal/domain"
 	"flow-indexer/internal/domain/account"
+	"flow-indexer/internal/domain/anomaly"
+	"flow-indexer/internal/domain/checkpoint"
 	flowEvent "flow-indexer/internal/domain/event"
 	"flow-indexer/internal/domain/inscription"
+	"flow-indexer/internal/domain/nft"
+	"flow-indexer/internal/domain/snapshot"
+	"flow-indexer/internal/domain/transfer"
+	"fmt"
+
+	"go.uber.org/zap"
 )
 
+// SnapshotInterval is the number of blocks between two balance snapshots.
+const SnapshotInterval = uint64(100000)
+
 type Service interface {
-	UpdateBalance(ctx context.Context, insName, address string, isDeposit bool) error
-	CreateFlowEvent(ctx context.Context, nftID uint64, account, event string, block uint64) error
+	// Transaction runs fn as a single unit of work, every Service call made
+	// with the context passed to fn is committed together or not at all.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	UpdateBalance(ctx context.Context, event *flowEvent.FlowEvent) (int64, error)
+	CreateFlowEvent(ctx context.Context, event *flowEvent.FlowEvent) (bool, error)
+	ScannedIntervals(ctx context.Context, eventType string) ([]checkpoint.Interval, error)
+	SaveCheckpoint(ctx context.Context, eventType string, startBlock, endBlock, height uint64) error
+	IndexedHeight(ctx context.Context) (uint64, error)
+	ListAnomalies(ctx context.Context, insName string) ([]anomaly.Anomaly, error)
+	RebuildBalances(ctx context.Context, insName string) error
+	VerifyBalances(ctx context.Context, insName string) ([]Mismatch, error)
+	ResetToHeight(ctx context.Context, height uint64) error
+	ListCheckpoints(ctx context.Context) ([]checkpoint.Checkpoint, error)
+	SnapshotBalances(ctx context.Context) error
+	BalanceAt(ctx context.Context, insName, address string, height uint64) (int64, error)
+	HoldersAt(ctx context.Context, insName string, height uint64) ([]snapshot.Snapshot, error)
+	UpdateOwnership(ctx context.Context, event *flowEvent.FlowEvent) error
+	GetOwnership(ctx context.Context, insName string, nftID uint64) (*nft.Ownership, error)
+	ListOwnerships(ctx context.Context, insName, owner string) ([]nft.Ownership, error)
+	GetOwnerships(ctx context.Context, insName string, nftIDs []uint64) ([]nft.Ownership, error)
+	ListOwnershipsByOwners(ctx context.Context, insName string, owners []string, limit int) ([]nft.Ownership, error)
+	PairTransfers(ctx context.Context, events []*flowEvent.FlowEvent) error
+	SupplyAt(ctx context.Context, insName string, height uint64) (*Supply, error)
+	ListBalances(ctx context.Context, address string) ([]inscription.Balance, error)
+	ListBalancesByAccounts(ctx context.Context, addresses []string) ([]inscription.Balance, error)
+	ListHolders(ctx context.Context, insName string, limit, offset int) ([]inscription.Balance, error)
+	ListEvents(ctx context.Context, address string, limit, offset int) ([]flowEvent.FlowEvent, error)
+	Leaderboard(ctx context.Context, insName string, cursor *inscription.Cursor, limit int) ([]inscription.Holder, uint64, error)
+	ListActivity(ctx context.Context, address string, filter flowEvent.ActivityFilter) ([]flowEvent.Activity, error)
+	ListEventsByAccounts(ctx context.Context, addresses []string, filter flowEvent.ActivityFilter) ([]flowEvent.FlowEvent, error)
+	GetProvenance(ctx context.Context, insName string, nftID uint64) (*Provenance, error)
+	PublishChanges(ctx context.Context, changes []flowEvent.Change) error
+	ListChanges(ctx context.Context, filter flowEvent.ChangeFilter, after flowEvent.Position, limit int) ([]flowEvent.Change, error)
 }
 
 type service struct {
+	transactor      domain.Transactor
 	accountRepo     account.Repository
 	inscriptionRepo inscription.Repository
 	eventRepo       flowEvent.Repository
+	checkpointRepo  checkpoint.Repository
+	anomalyRepo     anomaly.Repository
+	snapshotRepo    snapshot.Repository
+	nftRepo         nft.Repository
+	transferRepo    transfer.Repository
+	publisher       flowEvent.Publisher
 }
 
 func NewService(
+	transactor domain.Transactor,
 	accountRepo account.Repository,
 	inscriptionRepo inscription.Repository,
 	eventRepo flowEvent.Repository,
+	checkpointRepo checkpoint.Repository,
+	anomalyRepo anomaly.Repository,
+	snapshotRepo snapshot.Repository,
+	nftRepo nft.Repository,
+	transferRepo transfer.Repository,
+	publisher flowEvent.Publisher,
 ) Service {
 	return &service{
+		transactor:      transactor,
 		accountRepo:     accountRepo,
 		inscriptionRepo: inscriptionRepo,
 		eventRepo:       eventRepo,
+		checkpointRepo:  checkpointRepo,
+		anomalyRepo:     anomalyRepo,
+		snapshotRepo:    snapshotRepo,
+		nftRepo:         nftRepo,
+		transferRepo:    transferRepo,
+		publisher:       publisher,
 	}
 }
 
-func (s *service) UpdateBalance(ctx context.Context, insName, address string, isDeposit bool) error {
-	acc, err := s.accountRepo.FirstOrCreate(ctx, address)
+func (s *service) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.transactor.Transaction(ctx, fn)
+}
+
+// UpdateBalance applies event to the balance of its account and returns the
+// new balance. An event that makes the balance negative is still applied but
+// recorded as an anomaly. Deposits bringing a negative balance back up are
+// not anomalies.
+func (s *service) UpdateBalance(ctx context.Context, event *flowEvent.FlowEvent) (int64, error) {
+	acc, err := s.accountRepo.FirstOrCreate(ctx, event.Account)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	balance, err := s.inscriptionRepo.GetorCreateByInscriptionAndAddress(ctx, insName, acc.Address)
+	amount, err := s.inscriptionRepo.AddAmount(ctx, event.Inscription, acc.Address, event.Delta(), event.Block)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if event.Delta() >= 0 || amount >= 0 {
+		return amount, nil
+	}
+
+	return amount, s.anomalyRepo.Create(ctx, newAnomaly(event, amount))
+}
+
+func newAnomaly(event *flowEvent.FlowEvent, amount int64) *anomaly.Anomaly {
+	zap.L().Warn("negative balance",
+		zap.String("inscription", event.Inscription),
+		zap.String("account", event.Account),
+		zap.Int64("amount", amount),
+		zap.Uint64("block", event.Block),
+		zap.String("transactionID", event.TransactionID),
+	)
+	return &anomaly.Anomaly{
+		Inscription:      event.Inscription,
+		Account:          event.Account,
+		Event:            event.Event,
+		NFTID:            event.NFTID,
+		Block:            event.Block,
+		TransactionID:    event.TransactionID,
+		TransactionIndex: event.TransactionIndex,
+		EventIndex:       event.EventIndex,
+		Amount:           amount,
 	}
+}
 
-	if isDeposit {
-		balance.Amount += 1
-	} else {
-		balance.Amount -= 1
+// CreateFlowEvent stores an event and reports whether it is new. Events that
+// were already ingested are skipped and must not be applied again.
+func (s *service) CreateFlowEvent(ctx context.Context, event *flowEvent.FlowEvent) (bool, error) {
+	_, err := s.accountRepo.FirstOrCreate(ctx, event.Account)
+	if err != nil {
+		return false, err
 	}
 
-	err = s.inscriptionRepo.Update(ctx, balance)
+	return s.eventRepo.Create(ctx, event)
+}
+
+// ScannedIntervals returns the heights committed by the checkpoints of
+// eventType, whatever ranges they were scanned in, as sorted disjoint
+// intervals.
+func (s *service) ScannedIntervals(ctx context.Context, eventType string) ([]checkpoint.Interval, error) {
+	checkpoints, err := s.checkpointRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var scanned []checkpoint.Checkpoint
+	for _, cp := range checkpoints {
+		if cp.EventType == eventType {
+			scanned = append(scanned, cp)
+		}
+	}
+	return checkpoint.Completed(scanned), nil
+}
+
+// SaveCheckpoint records height as the last committed height of the given
+// block range.
+func (s *service) SaveCheckpoint(ctx context.Context, eventType string, startBlock, endBlock, height uint64) error {
+	return s.checkpointRepo.Save(ctx, &checkpoint.Checkpoint{
+		EventType:  eventType,
+		StartBlock: startBlock,
+		EndBlock:   endBlock,
+		Height:     height,
+	})
+}
+
+// IndexedHeight returns the height up to which every block is indexed, the
+// end of the scanned heights the lowest scan started from. Heights scanned
+// past a gap, by a follow ahead of an unfinished backfill or by a backfill
+// of a later range, only count once the gap is scanned.
+func (s *service) IndexedHeight(ctx context.Context) (uint64, error) {
+	indexed, err := s.indexed(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return indexed.End, nil
+}
+
+// indexed returns the heights from the lowest scanned one up to the indexed
+// height, the zero Interval if nothing is scanned.
+func (s *service) indexed(ctx context.Context) (checkpoint.Interval, error) {
+	checkpoints, err := s.checkpointRepo.List(ctx)
+	if err != nil {
+		return checkpoint.Interval{}, err
+	}
+
+	scanned := checkpoint.Completed(checkpoints)
+	if len(scanned) == 0 {
+		return checkpoint.Interval{}, nil
+	}
+	return scanned[0], nil
+}
+
+// ListAnomalies returns the recorded negative balance events in chain order.
+func (s *service) ListAnomalies(ctx context.Context, insName string) ([]anomaly.Anomaly, error) {
+	return s.anomalyRepo.List(ctx, insName)
+}
+
+// RebuildBalances recomputes the balances of insName, or of every
+// inscription if it is empty, by replaying the stored events in chain order.
+// Anomalies are recomputed along the way. The snapshots, which span the
+// inscriptions, are all taken again from the events. The new balances
+// replace the old ones at the end of a single transaction, so readers never
+// see a partial rebuild.
+func (s *service) RebuildBalances(ctx context.Context, insName string) error {
+	return s.Transaction(ctx, func(ctx context.Context) error {
+		balances, anomalies, err := s.replayBalances(ctx, insName)
+		if err != nil {
+			return err
+		}
+
+		err = s.inscriptionRepo.Replace(ctx, insName, balances)
+		if err != nil {
+			return err
+		}
+
+		err = s.anomalyRepo.Delete(ctx, insName)
+		if err != nil {
+			return err
+		}
+		for _, a := range anomalies {
+			err = s.anomalyRepo.Create(ctx, a)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = s.snapshotRepo.DeleteAbove(ctx, 0)
+		if err != nil {
+			return err
+		}
+		return s.takeSnapshots(ctx, 0)
+	})
+}
+
+// replayBalances computes the balances of insName, or of every inscription if
+// it is empty, and the anomalies met on the way from the stored events.
+func (s *service) replayBalances(ctx context.Context, insName string) ([]inscription.Balance, []*anomaly.Anomaly, error) {
+	type key struct {
+		inscription string
+		account     string
+	}
+
+	amounts := make(map[key]int64)
+	firstSeen := make(map[key]uint64)
+	var anomalies []*anomaly.Anomaly
+	err := s.eventRepo.Iterate(ctx, insName, func(event *flowEvent.FlowEvent) error {
+		k := key{inscription: event.Inscription, account: event.Account}
+		if _, ok := amounts[k]; !ok {
+			firstSeen[k] = event.Block
+		}
+		amounts[k] += event.Delta()
+		if event.Delta() < 0 && amounts[k] < 0 {
+			anomalies = append(anomalies, newAnomaly(event, amounts[k]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	balances := make([]inscription.Balance, 0, len(amounts))
+	for k, amount := range amounts {
+		balances = append(balances, inscription.Balance{
+			Account:         k.account,
+			Inscription:     k.inscription,
+			Amount:          amount,
+			FirstSeenHeight: firstSeen[k],
+		})
+	}
+	return balances, anomalies, nil
+}
+
+// SnapshotBalances takes the snapshots due every SnapshotInterval blocks
+// after the latest one, up to the indexed height. A snapshot is only taken
+// once every block below it is indexed, so it never misses events committed
+// later.
+func (s *service) SnapshotBalances(ctx context.Context) error {
+	latest, err := s.snapshotRepo.LatestHeight(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	return s.takeSnapshots(ctx, latest)
 }
 
-func (s *service) CreateFlowEvent(ctx context.Context, nftID uint64, account, event string, block uint64) error {
-	_, err := s.accountRepo.FirstOrCreate(ctx, account)
+// takeSnapshots takes the snapshots due above height up to the indexed
+// height, in chain order since each one builds on the previous.
+func (s *service) takeSnapshots(ctx context.Context, height uint64) error {
+	indexed, err := s.indexed(ctx)
 	if err != nil {
 		return err
 	}
 
-	fe := flowEvent.FlowEvent{
-		Account: account,
-		NFTID:   nftID,
-		Event:   event,
-		Block:   block,
+	// no balance exists before the first scanned block
+	from := height + 1
+	if from < indexed.Start {
+		from = indexed.Start
+	}
+	first := (from + SnapshotInterval - 1) / SnapshotInterval * SnapshotInterval
+	for h := first; h <= indexed.End; h += SnapshotInterval {
+		err = s.snapshotRepo.Create(ctx, h)
+		if err != nil {
+			return fmt.Errorf("snapshot height %d: %w", h, err)
+		}
+	}
+	return nil
+}
+
+// BalanceAt returns the balance of address for insName as of height.
+func (s *service) BalanceAt(ctx context.Context, insName, address string, height uint64) (int64, error) {
+	return s.snapshotRepo.BalanceAt(ctx, insName, address, height)
+}
+
+// HoldersAt returns the accounts holding insName and their balances as of
+// height.
+func (s *service) HoldersAt(ctx context.Context, insName string, height uint64) ([]snapshot.Snapshot, error) {
+	return s.snapshotRepo.HoldersAt(ctx, insName, height)
+}
+
+// UpdateOwnership moves the NFT of event to its account on Deposit, and out
+// of any account on Withdraw.
+func (s *service) UpdateOwnership(ctx context.Context, event *flowEvent.FlowEvent) error {
+	owner := ""
+	if event.IsDeposit() {
+		owner = event.Account
 	}
 
-	return s.eventRepo.Create(ctx, &fe)
+	return s.nftRepo.Save(ctx, &nft.Ownership{
+		Inscription:    event.Inscription,
+		NFTID:          event.NFTID,
+		Owner:          owner,
+		AcquiredHeight: event.Block,
+		LastTransferTx: event.TransactionID,
+	})
+}
+
+// GetOwnership returns the current owner of an NFT.
+func (s *service) GetOwnership(ctx context.Context, insName string, nftID uint64) (*nft.Ownership, error) {
+	return s.nftRepo.GetByNFTID(ctx, insName, nftID)
+}
+
+// ListOwnerships returns the NFTs currently held by owner.
+func (s *service) ListOwnerships(ctx context.Context, insName, owner string) ([]nft.Ownership, error) {
+	return s.nftRepo.ListByOwner(ctx, insName, owner)
+}
+
+// GetOwnerships returns the current owners of the NFTs among nftIDs that were
+// seen, in NFT ID order.
+func (s *service) GetOwnerships(ctx context.Context, insName string, nftIDs []uint64) ([]nft.Ownership, error) {
+	return s.nftRepo.ListByNFTIDs(ctx, insName, nftIDs)
+}
+
+// ListOwnershipsByOwners returns the NFTs currently held by every owner, at
+// most limit per owner.
+func (s *service) ListOwnershipsByOwners(
+	ctx context.Context, insName string, owners []string, limit int,
+) ([]nft.Ownership, error) {
+	return s.nftRepo.ListByOwners(ctx, insName, owners, limit)
+}
+
+// PublishChanges notifies listeners of changes once the surrounding
+// transaction commits.
+func (s *service) PublishChanges(ctx context.Context, changes []flowEvent.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	return s.publisher.Publish(ctx, changes)
 }
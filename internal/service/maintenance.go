@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"flow-indexer/internal/domain/checkpoint"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/nft"
+	"sort"
+)
+
+// Mismatch is a stored balance that differs from the balance replayed from
+// the events.
+type Mismatch struct {
+	Inscription string `json:"inscription"`
+	Account     string `json:"account"`
+	Stored      int64  `json:"stored"`
+	Expected    int64  `json:"expected"`
+}
+
+// VerifyBalances replays the stored events of insName, or of every
+// inscription if it is empty, and returns the stored balances that differ
+// from the replayed ones. A missing balance counts as zero.
+func (s *service) VerifyBalances(ctx context.Context, insName string) ([]Mismatch, error) {
+	type key struct {
+		inscription string
+		account     string
+	}
+
+	var mismatches []Mismatch
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		expected, _, err := s.replayBalances(ctx, insName)
+		if err != nil {
+			return err
+		}
+		stored, err := s.inscriptionRepo.List(ctx, insName)
+		if err != nil {
+			return err
+		}
+
+		amounts := make(map[key]int64, len(stored))
+		for _, b := range stored {
+			amounts[key{b.Inscription, b.Account}] = b.Amount
+		}
+		for _, b := range expected {
+			k := key{b.Inscription, b.Account}
+			if amounts[k] != b.Amount {
+				mismatches = append(mismatches, Mismatch{b.Inscription, b.Account, amounts[k], b.Amount})
+			}
+			delete(amounts, k)
+		}
+		// balances of accounts without any event
+		for k, amount := range amounts {
+			if amount != 0 {
+				mismatches = append(mismatches, Mismatch{k.inscription, k.account, amount, 0})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Inscription != mismatches[j].Inscription {
+			return mismatches[i].Inscription < mismatches[j].Inscription
+		}
+		return mismatches[i].Account < mismatches[j].Account
+	})
+	return mismatches, nil
+}
+
+// ResetToHeight rolls the index back to height: the events, transfers and
+// snapshots above it are removed, the checkpoints are rewound, the remaining
+// transfers of the NFTs that lost some are reclassified and the balances,
+// anomalies and NFT ownerships are rebuilt from the remaining events, all in
+// a single transaction. Indexing resumes at height+1.
+func (s *service) ResetToHeight(ctx context.Context, height uint64) error {
+	return s.Transaction(ctx, func(ctx context.Context) error {
+		err := s.eventRepo.DeleteAbove(ctx, height)
+		if err != nil {
+			return err
+		}
+		err = s.deleteTransfersAbove(ctx, height)
+		if err != nil {
+			return err
+		}
+		err = s.snapshotRepo.DeleteAbove(ctx, height)
+		if err != nil {
+			return err
+		}
+		err = s.checkpointRepo.Rewind(ctx, height)
+		if err != nil {
+			return err
+		}
+
+		err = s.RebuildBalances(ctx, "")
+		if err != nil {
+			return err
+		}
+		return s.rebuildOwnerships(ctx)
+	})
+}
+
+// rebuildOwnerships replaces the NFT ownerships with those replayed from the
+// stored events, see UpdateOwnership.
+func (s *service) rebuildOwnerships(ctx context.Context) error {
+	type key struct {
+		inscription string
+		nftID       uint64
+	}
+
+	owners := make(map[key]*nft.Ownership)
+	err := s.eventRepo.Iterate(ctx, "", func(event *flowEvent.FlowEvent) error {
+		owner := ""
+		if event.IsDeposit() {
+			owner = event.Account
+		}
+		owners[key{event.Inscription, event.NFTID}] = &nft.Ownership{
+			Inscription:    event.Inscription,
+			NFTID:          event.NFTID,
+			Owner:          owner,
+			AcquiredHeight: event.Block,
+			LastTransferTx: event.TransactionID,
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ownerships := make([]nft.Ownership, 0, len(owners))
+	for _, o := range owners {
+		ownerships = append(ownerships, *o)
+	}
+	return s.nftRepo.Replace(ctx, ownerships)
+}
+
+// ListCheckpoints returns the checkpoints of every block range worker.
+func (s *service) ListCheckpoints(ctx context.Context) ([]checkpoint.Checkpoint, error) {
+	return s.checkpointRepo.List(ctx)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flow-indexer/internal/domain"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/nft"
+	"flow-indexer/internal/domain/transfer"
+)
+
+// Provenance is the ownership history of an NFT. Transfers include the mint
+// and, if any, the burn.
+type Provenance struct {
+	Inscription string              `json:"inscription"`
+	NFTID       uint64              `json:"nft_id"`
+	Mint        *transfer.Transfer  `json:"mint"`
+	Transfers   []transfer.Transfer `json:"transfers"`
+	Owner       *nft.Ownership      `json:"owner"`
+}
+
+// GetProvenance returns the ownership history of an NFT, rebuilt from its
+// stored events, or domain.ErrNotFound if it has none.
+func (s *service) GetProvenance(ctx context.Context, insName string, nftID uint64) (*Provenance, error) {
+	events, err := s.eventRepo.ListByNFTID(ctx, insName, nftID)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	pointers := make([]*flowEvent.FlowEvent, len(events))
+	for i := range events {
+		pointers[i] = &events[i]
+	}
+
+	provenance := &Provenance{
+		Inscription: insName,
+		NFTID:       nftID,
+		Transfers:   pairTransfers(pointers),
+	}
+	for i := range provenance.Transfers {
+		if provenance.Transfers[i].Kind == transfer.KindMint {
+			provenance.Mint = &provenance.Transfers[i]
+			break
+		}
+	}
+
+	owner, err := s.nftRepo.GetByNFTID(ctx, insName, nftID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+	provenance.Owner = owner
+	return provenance, nil
+}
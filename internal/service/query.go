@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/inscription"
+)
+
+// ListBalances returns the non-zero balances of address.
+func (s *service) ListBalances(ctx context.Context, address string) ([]inscription.Balance, error) {
+	return s.inscriptionRepo.ListByAccount(ctx, address)
+}
+
+// ListBalancesByAccounts returns the non-zero balances of every address.
+func (s *service) ListBalancesByAccounts(ctx context.Context, addresses []string) ([]inscription.Balance, error) {
+	return s.inscriptionRepo.ListByAccounts(ctx, addresses)
+}
+
+// ListHolders returns a page of the accounts holding insName, largest
+// balance first.
+func (s *service) ListHolders(ctx context.Context, insName string, limit, offset int) ([]inscription.Balance, error) {
+	return s.inscriptionRepo.ListHolders(ctx, insName, limit, offset)
+}
+
+// ListEvents returns a page of the events of address, latest first.
+func (s *service) ListEvents(ctx context.Context, address string, limit, offset int) ([]flowEvent.FlowEvent, error) {
+	return s.eventRepo.ListByAccount(ctx, address, limit, offset)
+}
+
+// Leaderboard returns a page of the holders of insName ranked by balance as
+// of a height, starting after cursor, and the height. The first page is
+// ranked at the indexed height and the next ones at the height of their
+// cursor, so that pages stay consistent while blocks are indexed. Share is
+// the fraction of the total supply the holder owns.
+func (s *service) Leaderboard(
+	ctx context.Context, insName string, cursor *inscription.Cursor, limit int,
+) ([]inscription.Holder, uint64, error) {
+	var height uint64
+	if cursor != nil {
+		height = cursor.Height
+	} else {
+		var err error
+		height, err = s.IndexedHeight(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	holders, err := s.snapshotRepo.LeaderboardAt(ctx, insName, height, cursor, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	counts, err := s.transferRepo.CountAt(ctx, insName, height)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total := counts.Minted - counts.Burned; total > 0 {
+		for i := range holders {
+			holders[i].Share = float64(holders[i].Amount) / float64(total)
+		}
+	}
+	return holders, height, nil
+}
+
+// ListActivity returns the events of address matching filter in chain order,
+// each with the transfer it is part of.
+func (s *service) ListActivity(ctx context.Context, address string, filter flowEvent.ActivityFilter) ([]flowEvent.Activity, error) {
+	return s.eventRepo.ListActivity(ctx, address, filter)
+}
+
+// ListEventsByAccounts returns the events of every address matching filter in
+// chain order, at most filter.Limit per address.
+func (s *service) ListEventsByAccounts(
+	ctx context.Context, addresses []string, filter flowEvent.ActivityFilter,
+) ([]flowEvent.FlowEvent, error) {
+	return s.eventRepo.ListByAccounts(ctx, addresses, filter)
+}
+
+// ListChanges returns up to limit stored events matching filter after
+// position after, as changes without balances.
+func (s *service) ListChanges(
+	ctx context.Context, filter flowEvent.ChangeFilter, after flowEvent.Position, limit int,
+) ([]flowEvent.Change, error) {
+	events, err := s.eventRepo.ListChanges(ctx, filter, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]flowEvent.Change, len(events))
+	for i := range events {
+		changes[i] = flowEvent.Change{FlowEvent: events[i]}
+	}
+	return changes, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+)
+
+// Supply is the supply of an inscription as of a block height. Escrowed NFTs
+// exist but are held by no account, so they are not circulating.
+type Supply struct {
+	Inscription string `json:"inscription"`
+	Height      uint64 `json:"height"`
+	Minted      int64  `json:"minted"`
+	Burned      int64  `json:"burned"`
+	Total       int64  `json:"total"`
+	Escrowed    int64  `json:"escrowed"`
+	Circulating int64  `json:"circulating"`
+	Holders     int64  `json:"holders"`
+}
+
+// SupplyAt returns the supply of insName as of height. An NFT withdrawn
+// without being deposited in the same transaction is escrowed until it is
+// deposited again, and burned if it never is.
+func (s *service) SupplyAt(ctx context.Context, insName string, height uint64) (*Supply, error) {
+	counts, err := s.transferRepo.CountAt(ctx, insName, height)
+	if err != nil {
+		return nil, err
+	}
+
+	holders, err := s.snapshotRepo.HolderCountAt(ctx, insName, height)
+	if err != nil {
+		return nil, err
+	}
+
+	total := counts.Minted - counts.Burned
+	return &Supply{
+		Inscription: insName,
+		Height:      height,
+		Minted:      counts.Minted,
+		Burned:      counts.Burned,
+		Total:       total,
+		Escrowed:    counts.Escrowed,
+		Circulating: total - counts.Escrowed,
+		Holders:     holders,
+	}, nil
+}
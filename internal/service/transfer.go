@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/transfer"
+	"sort"
+)
+
+// nftKey identifies an NFT.
+type nftKey struct {
+	inscription string
+	nftID       uint64
+}
+
+// PairTransfers derives transfers from events, which must hold whole
+// transactions in chain order. The kinds of the stored transfers of their
+// NFTs are updated with the new history, a burn whose NFT is deposited again
+// was an escrow move, and a mint after an earlier Deposit of its NFT was a
+// return.
+func (s *service) PairTransfers(ctx context.Context, events []*flowEvent.FlowEvent) error {
+	added := pairTransfers(events)
+	stored, err := s.listNFTTransfers(ctx, added)
+	if err != nil {
+		return err
+	}
+	return s.transferRepo.Save(ctx, mergeTransfers(stored, added))
+}
+
+// deleteTransfersAbove removes the transfers of the blocks above height and
+// reclassifies the remaining transfers of their NFTs, whose escrow moves and
+// returns may have lost the Deposit that made them so.
+func (s *service) deleteTransfersAbove(ctx context.Context, height uint64) error {
+	deleted, err := s.transferRepo.DeleteAbove(ctx, height)
+	if err != nil {
+		return err
+	}
+	stored, err := s.listNFTTransfers(ctx, deleted)
+	if err != nil {
+		return err
+	}
+	return s.transferRepo.Save(ctx, mergeTransfers(stored, nil))
+}
+
+// listNFTTransfers returns the stored transfers of the NFTs of transfers.
+func (s *service) listNFTTransfers(ctx context.Context, transfers []transfer.Transfer) ([]transfer.Transfer, error) {
+	nftIDs := make(map[string][]uint64)
+	seen := make(map[nftKey]bool)
+	for _, t := range transfers {
+		k := nftKey{inscription: t.Inscription, nftID: t.NFTID}
+		if !seen[k] {
+			seen[k] = true
+			nftIDs[t.Inscription] = append(nftIDs[t.Inscription], t.NFTID)
+		}
+	}
+
+	var stored []transfer.Transfer
+	for insName, ids := range nftIDs {
+		found, err := s.transferRepo.ListByNFTIDs(ctx, insName, ids)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, found...)
+	}
+	return stored, nil
+}
+
+// mergeTransfers classifies added together with the stored transfers of
+// their NFTs, and returns added along with the stored transfers whose kind
+// changed.
+func mergeTransfers(stored, added []transfer.Transfer) []transfer.Transfer {
+	type identity struct {
+		nftKey
+		txID       string
+		eventIndex int
+	}
+	id := func(t *transfer.Transfer) identity {
+		return identity{nftKey{t.Inscription, t.NFTID}, t.TransactionID, t.EventIndex}
+	}
+
+	kinds := make(map[identity]string, len(stored))
+	history := make([]transfer.Transfer, 0, len(stored)+len(added))
+	for i := range stored {
+		kinds[id(&stored[i])] = stored[i].Kind
+		history = append(history, stored[i])
+	}
+	for i := range added {
+		if _, ok := kinds[id(&added[i])]; !ok {
+			history = append(history, added[i])
+		}
+	}
+	sortTransfers(history)
+	classifyTransfers(history)
+
+	var changed []transfer.Transfer
+	for _, t := range history {
+		if kind, ok := kinds[id(&t)]; !ok || kind != t.Kind {
+			changed = append(changed, t)
+		}
+	}
+	return changed
+}
+
+// pairTransfers pairs every Withdraw with the next Deposit of the same NFT in
+// the same transaction. Deposits left unpaired are mints if they are the
+// first Deposit of their NFT in events and returns otherwise. Withdraws left
+// unpaired are escrow moves if their NFT is deposited later in events and
+// burns otherwise.
+func pairTransfers(events []*flowEvent.FlowEvent) []transfer.Transfer {
+	type key struct {
+		txID        string
+		inscription string
+		nftID       uint64
+	}
+
+	var transfers []transfer.Transfer
+	withdraws := make(map[key]*flowEvent.FlowEvent)
+	for _, e := range events {
+		k := key{txID: e.TransactionID, inscription: e.Inscription, nftID: e.NFTID}
+		if !e.IsDeposit() {
+			if w, ok := withdraws[k]; ok {
+				transfers = append(transfers, newTransfer(transfer.KindBurn, w, w.Account, ""))
+			}
+			withdraws[k] = e
+			continue
+		}
+
+		if w, ok := withdraws[k]; ok {
+			transfers = append(transfers, newTransfer(transfer.KindTransfer, e, w.Account, e.Account))
+			delete(withdraws, k)
+			continue
+		}
+		transfers = append(transfers, newTransfer(transfer.KindMint, e, "", e.Account))
+	}
+	for _, w := range withdraws {
+		transfers = append(transfers, newTransfer(transfer.KindBurn, w, w.Account, ""))
+	}
+
+	sortTransfers(transfers)
+	classifyTransfers(transfers)
+	return transfers
+}
+
+// classifyTransfers sets the kind of the unpaired Deposits and Withdraws
+// among transfers, which must be in chain order, from the history of their
+// NFT. A Deposit is the mint of its NFT if it is the first one, a return
+// otherwise. A Withdraw is an escrow move if the NFT is deposited later, a
+// burn otherwise.
+func classifyTransfers(transfers []transfer.Transfer) {
+	deposited := make(map[nftKey]bool)
+	for i := range transfers {
+		t := &transfers[i]
+		k := nftKey{inscription: t.Inscription, nftID: t.NFTID}
+		switch t.Kind {
+		case transfer.KindMint, transfer.KindReturn:
+			t.Kind = transfer.KindMint
+			if deposited[k] {
+				t.Kind = transfer.KindReturn
+			}
+			deposited[k] = true
+		case transfer.KindTransfer:
+			deposited[k] = true
+		}
+	}
+
+	depositedLater := make(map[nftKey]bool)
+	for i := len(transfers) - 1; i >= 0; i-- {
+		t := &transfers[i]
+		k := nftKey{inscription: t.Inscription, nftID: t.NFTID}
+		if t.IsDeposit() {
+			depositedLater[k] = true
+			continue
+		}
+
+		t.Kind = transfer.KindBurn
+		if depositedLater[k] {
+			t.Kind = transfer.KindEscrow
+		}
+	}
+}
+
+func sortTransfers(transfers []transfer.Transfer) {
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].Position().Less(transfers[j].Position())
+	})
+}
+
+func newTransfer(kind string, e *flowEvent.FlowEvent, from, to string) transfer.Transfer {
+	return transfer.Transfer{
+		Inscription:      e.Inscription,
+		NFTID:            e.NFTID,
+		Kind:             kind,
+		From:             from,
+		To:               to,
+		Block:            e.Block,
+		TransactionID:    e.TransactionID,
+		TransactionIndex: e.TransactionIndex,
+		EventIndex:       e.EventIndex,
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	flowEvent "flow-indexer/internal/domain/event"
+	"flow-indexer/internal/domain/transfer"
+	"reflect"
+	"testing"
+)
+
+const (
+	testDeposit  = "A.88dd257fcf26d3cc.Inscription.Deposit"
+	testWithdraw = "A.88dd257fcf26d3cc.Inscription.Withdraw"
+)
+
+// testEvent is an event of the freeflow NFT nftID in transaction tx of block,
+// at eventIndex.
+func testEvent(eventType, acc string, nftID, block uint64, tx string, eventIndex int) *flowEvent.FlowEvent {
+	return &flowEvent.FlowEvent{
+		Account:       acc,
+		Inscription:   "freeflow",
+		NFTID:         nftID,
+		Event:         eventType,
+		Block:         block,
+		TransactionID: tx,
+		EventIndex:    eventIndex,
+	}
+}
+
+// testTransfer is a transfer of the freeflow NFT nftID in transaction tx of
+// block, at eventIndex.
+func testTransfer(kind, from, to string, nftID, block uint64, tx string, eventIndex int) transfer.Transfer {
+	return transfer.Transfer{
+		Inscription:   "freeflow",
+		NFTID:         nftID,
+		Kind:          kind,
+		From:          from,
+		To:            to,
+		Block:         block,
+		TransactionID: tx,
+		EventIndex:    eventIndex,
+	}
+}
+
+func TestPairTransfers(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []*flowEvent.FlowEvent
+		want   []transfer.Transfer
+	}{
+		{
+			name: "paired transfer",
+			events: []*flowEvent.FlowEvent{
+				testEvent(testWithdraw, "a", 1, 10, "tx1", 0),
+				testEvent(testDeposit, "b", 1, 10, "tx1", 1),
+			},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindTransfer, "a", "b", 1, 10, "tx1", 1),
+			},
+		},
+		{
+			name: "unpaired deposit",
+			events: []*flowEvent.FlowEvent{
+				testEvent(testDeposit, "a", 1, 10, "tx1", 0),
+			},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindMint, "", "a", 1, 10, "tx1", 0),
+			},
+		},
+		{
+			name: "unpaired withdraw",
+			events: []*flowEvent.FlowEvent{
+				testEvent(testWithdraw, "a", 1, 10, "tx1", 0),
+			},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindBurn, "a", "", 1, 10, "tx1", 0),
+			},
+		},
+		{
+			name: "deposit in another transaction",
+			events: []*flowEvent.FlowEvent{
+				testEvent(testWithdraw, "a", 1, 10, "tx1", 0),
+				testEvent(testDeposit, "b", 1, 12, "tx2", 0),
+			},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindEscrow, "a", "", 1, 10, "tx1", 0),
+				testTransfer(transfer.KindMint, "", "b", 1, 12, "tx2", 0),
+			},
+		},
+		{
+			name: "withdraw and later deposit",
+			events: []*flowEvent.FlowEvent{
+				testEvent(testDeposit, "a", 1, 10, "tx1", 0),
+				testEvent(testWithdraw, "a", 1, 11, "tx2", 0),
+				testEvent(testDeposit, "b", 1, 12, "tx3", 0),
+				testEvent(testWithdraw, "b", 1, 13, "tx4", 0),
+			},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindMint, "", "a", 1, 10, "tx1", 0),
+				testTransfer(transfer.KindEscrow, "a", "", 1, 11, "tx2", 0),
+				testTransfer(transfer.KindReturn, "", "b", 1, 12, "tx3", 0),
+				testTransfer(transfer.KindBurn, "b", "", 1, 13, "tx4", 0),
+			},
+		},
+		{
+			name: "several NFTs in one transaction",
+			events: []*flowEvent.FlowEvent{
+				testEvent(testWithdraw, "a", 1, 10, "tx1", 0),
+				testEvent(testWithdraw, "a", 2, 10, "tx1", 1),
+				testEvent(testDeposit, "b", 2, 10, "tx1", 2),
+				testEvent(testDeposit, "c", 1, 10, "tx1", 3),
+				testEvent(testWithdraw, "a", 3, 10, "tx1", 4),
+				testEvent(testDeposit, "c", 4, 10, "tx1", 5),
+			},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindTransfer, "a", "b", 2, 10, "tx1", 2),
+				testTransfer(transfer.KindTransfer, "a", "c", 1, 10, "tx1", 3),
+				testTransfer(transfer.KindBurn, "a", "", 3, 10, "tx1", 4),
+				testTransfer(transfer.KindMint, "", "c", 4, 10, "tx1", 5),
+			},
+		},
+		{
+			name: "same NFT twice in one transaction",
+			events: []*flowEvent.FlowEvent{
+				testEvent(testWithdraw, "a", 1, 10, "tx1", 0),
+				testEvent(testDeposit, "b", 1, 10, "tx1", 1),
+				testEvent(testWithdraw, "b", 1, 10, "tx1", 2),
+				testEvent(testDeposit, "c", 1, 10, "tx1", 3),
+			},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindTransfer, "a", "b", 1, 10, "tx1", 1),
+				testTransfer(transfer.KindTransfer, "b", "c", 1, 10, "tx1", 3),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pairTransfers(tt.events)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pairTransfers() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTransfers(t *testing.T) {
+	mint := testTransfer(transfer.KindMint, "", "a", 1, 10, "tx1", 0)
+	tests := []struct {
+		name   string
+		stored []transfer.Transfer
+		added  []*flowEvent.FlowEvent
+		want   []transfer.Transfer
+	}{
+		{
+			name:   "withdraw then later deposit",
+			stored: []transfer.Transfer{mint, testTransfer(transfer.KindBurn, "a", "", 1, 11, "tx2", 0)},
+			added:  []*flowEvent.FlowEvent{testEvent(testDeposit, "b", 1, 12, "tx3", 0)},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindEscrow, "a", "", 1, 11, "tx2", 0),
+				testTransfer(transfer.KindReturn, "", "b", 1, 12, "tx3", 0),
+			},
+		},
+		{
+			name:   "withdraw not deposited again",
+			stored: []transfer.Transfer{mint},
+			added:  []*flowEvent.FlowEvent{testEvent(testWithdraw, "a", 1, 11, "tx2", 0)},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindBurn, "a", "", 1, 11, "tx2", 0),
+			},
+		},
+		{
+			name: "withdraw committed after the later deposit",
+			stored: []transfer.Transfer{
+				mint,
+				testTransfer(transfer.KindReturn, "", "b", 1, 12, "tx3", 0),
+			},
+			added: []*flowEvent.FlowEvent{testEvent(testWithdraw, "a", 1, 11, "tx2", 0)},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindEscrow, "a", "", 1, 11, "tx2", 0),
+			},
+		},
+		{
+			name: "deposit committed before the mint",
+			stored: []transfer.Transfer{
+				testTransfer(transfer.KindMint, "", "b", 1, 12, "tx3", 0),
+			},
+			added: []*flowEvent.FlowEvent{testEvent(testDeposit, "a", 1, 10, "tx1", 0)},
+			want: []transfer.Transfer{
+				mint,
+				testTransfer(transfer.KindReturn, "", "b", 1, 12, "tx3", 0),
+			},
+		},
+		{
+			name:   "other NFT",
+			stored: []transfer.Transfer{mint},
+			added:  []*flowEvent.FlowEvent{testEvent(testDeposit, "b", 2, 12, "tx3", 0)},
+			want: []transfer.Transfer{
+				testTransfer(transfer.KindMint, "", "b", 2, 12, "tx3", 0),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeTransfers(tt.stored, pairTransfers(tt.added))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeTransfers() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// memTransfers is a transfer.Repository keeping the transfers in memory.
+type memTransfers struct {
+	transfer.Repository
+	transfers []transfer.Transfer
+}
+
+func (m *memTransfers) Save(_ context.Context, transfers []transfer.Transfer) error {
+	for _, t := range transfers {
+		i := 0
+		for i < len(m.transfers) && (m.transfers[i].NFTID != t.NFTID ||
+			m.transfers[i].TransactionID != t.TransactionID || m.transfers[i].EventIndex != t.EventIndex) {
+			i++
+		}
+		if i == len(m.transfers) {
+			m.transfers = append(m.transfers, t)
+		}
+		m.transfers[i].Kind = t.Kind
+	}
+	sortTransfers(m.transfers)
+	return nil
+}
+
+func (m *memTransfers) ListByNFTIDs(_ context.Context, _ string, nftIDs []uint64) ([]transfer.Transfer, error) {
+	var found []transfer.Transfer
+	for _, t := range m.transfers {
+		for _, id := range nftIDs {
+			if t.NFTID == id {
+				found = append(found, t)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (m *memTransfers) DeleteAbove(_ context.Context, height uint64) ([]transfer.Transfer, error) {
+	var kept, deleted []transfer.Transfer
+	for _, t := range m.transfers {
+		if t.Block > height {
+			deleted = append(deleted, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	m.transfers = kept
+	return deleted, nil
+}
+
+func TestDeleteTransfersAbove(t *testing.T) {
+	repo := &memTransfers{}
+	s := &service{transferRepo: repo}
+	ctx := context.Background()
+
+	err := s.PairTransfers(ctx, []*flowEvent.FlowEvent{
+		testEvent(testDeposit, "a", 1, 10, "tx1", 0),
+		testEvent(testWithdraw, "a", 1, 11, "tx2", 0),
+		testEvent(testDeposit, "b", 1, 12, "tx3", 0),
+		testEvent(testDeposit, "c", 2, 12, "tx3", 1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.transfers[1].Kind; got != transfer.KindEscrow {
+		t.Fatalf("withdraw before the reset is %s, want %s", got, transfer.KindEscrow)
+	}
+
+	err = s.deleteTransfersAbove(ctx, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []transfer.Transfer{
+		testTransfer(transfer.KindMint, "", "a", 1, 10, "tx1", 0),
+		testTransfer(transfer.KindBurn, "a", "", 1, 11, "tx2", 0),
+	}
+	if !reflect.DeepEqual(repo.transfers, want) {
+		t.Errorf("transfers after the reset =\n%+v\nwant\n%+v", repo.transfers, want)
+	}
+}
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"errors"
+	"flow-indexer/internal/domain/event"
+	"sync"
+)
+
+// ErrSlowConsumer ends a subscription that did not keep up with the changes
+// published to it.
+var ErrSlowConsumer = errors.New("slow consumer")
+
+// Hub fans out published changes to its subscriptions. Publishing never
+// blocks: a subscription whose buffer is full is closed with
+// ErrSlowConsumer, and its consumer is expected to resume from the event
+// log.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the published changes accepted by its match
+// function.
+type Subscription struct {
+	hub   *Hub
+	match func(change *event.Change) bool
+	c     chan event.Change
+	err   error
+}
+
+// Subscribe registers a subscription buffering up to buffer changes. The
+// subscription must be closed once it is no longer used.
+func (h *Hub) Subscribe(match func(change *event.Change) bool, buffer int) *Subscription {
+	s := &Subscription{
+		hub:   h,
+		match: match,
+		c:     make(chan event.Change, buffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.c)
+		return s
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Publish sends change to every subscription that matches it.
+func (h *Hub) Publish(change event.Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if !s.match(&change) {
+			continue
+		}
+		select {
+		case s.c <- change:
+		default:
+			h.remove(s, ErrSlowConsumer)
+		}
+	}
+}
+
+// Close ends every subscription, later subscriptions are closed right away.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		h.remove(s, nil)
+	}
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(s *Subscription, err error) {
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	s.err = err
+	close(s.c)
+}
+
+// C returns the channel changes are delivered on. It is closed when the
+// subscription ends, after which Err tells why.
+func (s *Subscription) C() <-chan event.Change {
+	return s.c
+}
+
+// Err returns ErrSlowConsumer if the subscription was dropped for falling
+// behind, nil otherwise. It must only be called once C is closed.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s, nil)
+}
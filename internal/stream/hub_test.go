@@ -0,0 +1,102 @@
+package stream
+
+import (
+	"errors"
+	"flow-indexer/internal/domain/event"
+	"testing"
+)
+
+func all(*event.Change) bool { return true }
+
+func testChange(block uint64) event.Change {
+	return event.Change{FlowEvent: event.FlowEvent{Inscription: "freeflow", Block: block}}
+}
+
+// drain returns the changes buffered in s until its channel is closed.
+func drain(t *testing.T, s *Subscription) []event.Change {
+	t.Helper()
+	var changes []event.Change
+	for {
+		select {
+		case change, ok := <-s.C():
+			if !ok {
+				return changes
+			}
+			changes = append(changes, change)
+		default:
+			t.Fatal("subscription is still open")
+		}
+	}
+}
+
+func TestHubSlowConsumer(t *testing.T) {
+	h := NewHub()
+	slow := h.Subscribe(all, 1)
+	fast := h.Subscribe(all, 4)
+	defer fast.Close()
+
+	h.Publish(testChange(1))
+	h.Publish(testChange(2))
+
+	got := drain(t, slow)
+	if len(got) != 1 || got[0].Block != 1 {
+		t.Errorf("slow consumer got %+v, want the change of block 1", got)
+	}
+	if !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Errorf("slow consumer Err() = %v, want %v", slow.Err(), ErrSlowConsumer)
+	}
+
+	h.Publish(testChange(3))
+	if n := len(fast.C()); n != 3 {
+		t.Errorf("other subscriber has %d changes, want 3", n)
+	}
+	if fast.Err() != nil {
+		t.Errorf("other subscriber Err() = %v, want nil", fast.Err())
+	}
+
+	// closing an evicted subscription is a no-op
+	slow.Close()
+	if !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Errorf("Err() after Close = %v, want %v", slow.Err(), ErrSlowConsumer)
+	}
+}
+
+func TestHubMatch(t *testing.T) {
+	h := NewHub()
+	even := h.Subscribe(func(change *event.Change) bool { return change.Block%2 == 0 }, 4)
+	defer even.Close()
+
+	for block := uint64(1); block <= 4; block++ {
+		h.Publish(testChange(block))
+	}
+	// a non-matching change never fills the buffer
+	if n := len(even.C()); n != 2 {
+		t.Fatalf("subscriber has %d changes, want 2", n)
+	}
+	for _, want := range []uint64{2, 4} {
+		if got := <-even.C(); got.Block != want {
+			t.Errorf("got the change of block %d, want %d", got.Block, want)
+		}
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub()
+	s := h.Subscribe(all, 4)
+	h.Publish(testChange(1))
+	h.Close()
+
+	got := drain(t, s)
+	if len(got) != 1 {
+		t.Errorf("got %d changes, want the one published before Close", len(got))
+	}
+	if s.Err() != nil {
+		t.Errorf("Err() = %v, want nil", s.Err())
+	}
+
+	late := h.Subscribe(all, 4)
+	if got := drain(t, late); len(got) != 0 {
+		t.Errorf("subscription after Close got %+v", got)
+	}
+	h.Publish(testChange(2))
+}
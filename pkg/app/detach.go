@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// Detach returns a context carrying the values of parent that is never
+// cancelled, for work that must finish once started, such as committing a
+// batch while shutting down.
+func Detach(parent context.Context) context.Context {
+	return detached{parent}
+}
+
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+func (d detached) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
@@ -11,15 +11,27 @@ import (
 	"flow-indexer/pkg/log"
 )
 
+// exitInterrupted is the exit code of a process stopped by a second signal,
+// following the shell convention for SIGINT.
+const exitInterrupted = 130
+
+// GraceCtx returns a context cancelled on the first SIGINT or SIGTERM, so
+// that the work in progress can finish. A second signal exits at once with
+// code 130.
 func GraceCtx(parent context.Context) (ctx context.Context) {
 	ctx, cancel := context.WithCancel(parent)
 	go func() {
-		quitChan := make(chan os.Signal, 1)
+		quitChan := make(chan os.Signal, 2)
 		signal.Notify(quitChan, os.Interrupt, syscall.SIGTERM)
 		sig := <-quitChan
 		_, logger := log.Context(parent, "app")
 		logger.With(zap.String("signal", sig.String())).Warn("graceful_shutdown")
 		cancel()
+
+		sig = <-quitChan
+		logger.With(zap.String("signal", sig.String())).Warn("forced_shutdown")
+		_ = logger.Sync()
+		os.Exit(exitInterrupted)
 	}()
 	return ctx
 }
@@ -6,6 +6,8 @@ import (
 )
 
 const (
+	FreeflowInscription = "freeflow"
+
 	FreeflowDepositEventType  = "A.88dd257fcf26d3cc.Inscription.Deposit"
 	FreeflowWithdrawEventType = "A.88dd257fcf26d3cc.Inscription.Withdraw"
 )
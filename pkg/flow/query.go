@@ -0,0 +1,75 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	flowGo "github.com/onflow/flow-go-sdk"
+	"github.com/onflow/flow-go-sdk/client"
+)
+
+// BlockEvent is an event together with the height of the block it was
+// emitted in.
+type BlockEvent struct {
+	flowGo.Event
+	Height uint64
+}
+
+// Batch is the events of a block range, ordered as they happened on chain.
+type Batch struct {
+	StartBlock uint64
+	EndBlock   uint64
+	Events     []BlockEvent
+}
+
+// GetEventsForHeightRange queries every event type over
+// [startBlock, endBlock] and merges the results in
+// (height, transaction index, event index) order.
+func GetEventsForHeightRange(
+	ctx context.Context, flowClient *client.Client, eventTypes []string, startBlock, endBlock uint64,
+) (Batch, error) {
+	batch := Batch{StartBlock: startBlock, EndBlock: endBlock}
+	for _, eventType := range eventTypes {
+		bes, err := flowClient.GetEventsForHeightRange(ctx,
+			client.EventRangeQuery{
+				Type:        eventType,
+				StartHeight: startBlock,
+				EndHeight:   endBlock,
+			})
+		if err != nil {
+			return Batch{}, fmt.Errorf("%s range %v - %v: %w", eventType, startBlock, endBlock, err)
+		}
+
+		for _, be := range bes {
+			for _, e := range be.Events {
+				if e.Type != eventType {
+					continue
+				}
+				batch.Events = append(batch.Events, BlockEvent{Event: e, Height: be.Height})
+			}
+		}
+	}
+
+	sort.SliceStable(batch.Events, func(i, j int) bool {
+		a, b := batch.Events[i], batch.Events[j]
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if a.TransactionIndex != b.TransactionIndex {
+			return a.TransactionIndex < b.TransactionIndex
+		}
+		return a.EventIndex < b.EventIndex
+	})
+
+	return batch, nil
+}
+
+// CheckpointKey returns the key checkpoints of a scan over eventTypes are
+// stored under.
+func CheckpointKey(eventTypes []string) string {
+	types := append([]string(nil), eventTypes...)
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
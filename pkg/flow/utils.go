@@ -2,9 +2,14 @@ package flow
 
 import (
 	"context"
+	"flow-indexer/internal/domain/checkpoint"
+	flowEventDomain "flow-indexer/internal/domain/event"
 	"flow-indexer/internal/service"
+	"flow-indexer/pkg/app"
 	"fmt"
+	"math"
 	"sync"
+	"time"
 
 	"github.com/onflow/flow-go-sdk/client"
 	"go.uber.org/zap"
@@ -15,111 +20,332 @@ type BlockRange struct {
 	EndBlock   uint64
 }
 
-func GetBlockRanges(startBlock, endBlock, thread uint64) []BlockRange {
-	totalBlocks := endBlock - startBlock + 1
-	groupSize := totalBlocks / thread
-	if groupSize == 0 {
-		groupSize = 1
+type batchResult struct {
+	batch Batch
+	err   error
+}
+
+// ScanRanges scans the heights of [startBlock, endBlock] that no checkpoint
+// of eventTypes covers yet, in batches of maxBlockQuery blocks. Batches are
+// fetched by thread concurrent workers but applied one by one in chain order.
+// Every uncovered part is scanned as a range of its own whose checkpoint is
+// advanced after every committed batch, so a later scan resumes whatever the
+// bounds or threads it is run with. Scanning stops at the first failed batch
+// so that a restart picks it up again. Once ctx is done no further batch is
+// committed, the batch being committed still is, and ScanRanges returns
+// ctx.Err().
+func ScanRanges(
+	ctx context.Context,
+	startBlock, endBlock uint64,
+	maxBlockQuery uint64,
+	thread int,
+	flowClient *client.Client,
+	logger *zap.Logger,
+	svc service.Service,
+	eventTypes []string,
+) error {
+	key := CheckpointKey(eventTypes)
+	scanned, err := svc.ScannedIntervals(ctx, key)
+	if err != nil {
+		return fmt.Errorf("ScannedIntervals: %w", err)
+	}
+
+	// plan the remaining batches in chain order
+	var batches []BlockRange
+	var owners []BlockRange
+	for _, gap := range checkpoint.Missing(scanned, startBlock, endBlock) {
+		r := BlockRange{StartBlock: gap.Start, EndBlock: gap.End}
+		logger.Info("scan range", zap.Uint64("startBlock", r.StartBlock), zap.Uint64("endBlock", r.EndBlock))
+
+		for i := r.StartBlock; i <= r.EndBlock; i += maxBlockQuery {
+			end := i + maxBlockQuery - 1
+			if end > r.EndBlock {
+				end = r.EndBlock
+			}
+			batches = append(batches, BlockRange{StartBlock: i, EndBlock: end})
+			owners = append(owners, r)
+		}
+	}
+	if len(batches) == 0 {
+		logger.Info("range already scanned", zap.Uint64("startBlock", startBlock), zap.Uint64("endBlock", endBlock))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// at most 2*thread batches are fetched ahead of the applied one
+	window := make(chan struct{}, 2*thread)
+	results := make([]chan batchResult, len(batches))
+	for i := range results {
+		results[i] = make(chan batchResult, 1)
+	}
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		for i := range batches {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for t := 0; t < thread; t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				batch, err := GetEventsForHeightRange(ctx, flowClient, eventTypes, batches[i].StartBlock, batches[i].EndBlock)
+				results[i] <- batchResult{batch: batch, err: err}
+			}
+		}()
 	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
 
-	var blockRanges []BlockRange
-	for i := startBlock; i <= endBlock; i += groupSize {
-		end := i + groupSize - 1
-		if end > endBlock {
-			end = endBlock
+	for i := range batches {
+		var res batchResult
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+		<-window
 
-		blockRanges = append(blockRanges, BlockRange{
-			StartBlock: i,
-			EndBlock:   end,
-		})
+		// fetches are cancelled on shutdown, don't report them as failed
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if res.err != nil {
+			logger.Error("GetEventsForHeightRange", zap.Error(res.err))
+			return res.err
+		}
 
-		if end == endBlock {
-			break
+		err = CommitBatch(app.Detach(ctx), res.batch, key, owners[i], logger, svc)
+		if err != nil {
+			return err
 		}
 	}
 
-	return blockRanges
+	return nil
 }
 
-func ScanRangeEvents(
-	startBlock, endBlock, maxBlockQuery uint64,
+// ScanBatchEvents fetches the events of [startBlock, endBlock] and commits
+// them together with the checkpoint of checkpointRange. The fetch is
+// cancelled with ctx but a started commit is not, so that the checkpoint
+// always matches the committed events.
+func ScanBatchEvents(
+	ctx context.Context,
+	startBlock, endBlock uint64,
+	checkpointRange BlockRange,
 	flowClient *client.Client,
 	logger *zap.Logger,
 	svc service.Service,
-	eventType string,
-	wg *sync.WaitGroup,
-) {
-	go func() {
-		for i := startBlock; i <= endBlock; i += maxBlockQuery {
-			end := i + maxBlockQuery - 1
-			if end > endBlock {
-				end = endBlock
-			}
+	eventTypes []string,
+) error {
+	batch, err := GetEventsForHeightRange(ctx, flowClient, eventTypes, startBlock, endBlock)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		logger.Error("GetEventsForHeightRange", zap.Error(err))
+		return err
+	}
 
-			ScanBatchEvents(i, end, flowClient, logger, svc, eventType)
+	return CommitBatch(app.Detach(ctx), batch, CheckpointKey(eventTypes), checkpointRange, logger, svc)
+}
+
+// CommitBatch applies batch, advances the checkpoint of checkpointRange to
+// the end of the batch and takes the balance snapshots this completes, in a
+// single transaction.
+func CommitBatch(
+	ctx context.Context,
+	batch Batch,
+	checkpointKey string,
+	checkpointRange BlockRange,
+	logger *zap.Logger,
+	svc service.Service,
+) error {
+	return svc.Transaction(ctx, func(ctx context.Context) error {
+		err := ApplyBatchEvents(ctx, batch, logger, svc)
+		if err != nil {
+			return err
 		}
-		defer wg.Done()
-	}()
+
+		err = svc.SaveCheckpoint(ctx, checkpointKey, checkpointRange.StartBlock, checkpointRange.EndBlock, batch.EndBlock)
+		if err != nil {
+			return fmt.Errorf(
+				"SaveCheckpoint range %v - %v: %w", checkpointRange.StartBlock, checkpointRange.EndBlock, err,
+			)
+		}
+
+		// snapshots wait for the blocks below them, which another range or
+		// process may still be scanning
+		err = svc.SnapshotBalances(ctx)
+		if err != nil {
+			return fmt.Errorf("SnapshotBalances: %w", err)
+		}
+		return nil
+	})
 }
 
-func ScanBatchEvents(
-	startBlock, endBlock uint64, flowClient *client.Client, logger *zap.Logger, svc service.Service, eventType string,
-) {
-	bes, err := flowClient.GetEventsForHeightRange(context.Background(),
-		client.EventRangeQuery{
-			Type:        eventType,
-			StartHeight: startBlock,
-			EndHeight:   endBlock,
-		})
+// ApplyBatchEvents stores the events of batch and updates balances and NFT
+// ownership in the order the events appear in the batch, then pairs the new
+// events into transfers and publishes them as changes. It is meant to run
+// inside svc.Transaction so that a failed batch leaves nothing behind.
+func ApplyBatchEvents(ctx context.Context, batch Batch, logger *zap.Logger, svc service.Service) error {
+	var created []*flowEventDomain.FlowEvent
+	var changes []flowEventDomain.Change
+	for _, e := range batch.Events {
+		logger.Debug("Event", zap.String("Type", e.Type))
+		logger.Debug("Event", zap.Uint64("BlockHeight", e.Height))
+		logger.Debug("Event", zap.String("TransactionID", e.TransactionID.String()))
+		logger.Debug("Event", zap.String("TransactionIndex", fmt.Sprintf("%d", e.TransactionIndex)))
+		logger.Debug("Event", zap.String("EventIndex", fmt.Sprintf("%d", e.EventIndex)))
+
+		// NOTE: the struct of deposit and withdraw events are the same
+		// so we can use the same function to parse them
+		flowEvent := FreeflowDeposit(e.Event)
+		logger.Debug("Event", zap.Uint64("ID", flowEvent.ID()))
+		logger.Debug("Event", zap.String("Address", fmt.Sprintf("%x", flowEvent.Address())))
+
+		fe := &flowEventDomain.FlowEvent{
+			Account:          fmt.Sprintf("%x", flowEvent.Address()),
+			Inscription:      FreeflowInscription,
+			NFTID:            flowEvent.ID(),
+			Event:            e.Type,
+			Block:            e.Height,
+			TransactionID:    e.TransactionID.String(),
+			TransactionIndex: e.TransactionIndex,
+			EventIndex:       e.EventIndex,
+		}
+		isNew, err := svc.CreateFlowEvent(ctx, fe)
+		if err != nil {
+			logger.Error("CreateFlowEvent", zap.Error(err))
+			return err
+		}
+		if !isNew {
+			logger.Debug("skip ingested event", zap.String("TransactionID", fe.TransactionID), zap.Int("EventIndex", fe.EventIndex))
+			continue
+		}
+		created = append(created, fe)
+
+		balance, err := svc.UpdateBalance(ctx, fe)
+		if err != nil {
+			logger.Error("UpdateBalance", zap.Error(
+				fmt.Errorf(
+					"address: %s, height: %v, range %v - %v: %w", fe.Account, e.Height, batch.StartBlock, batch.EndBlock, err,
+				),
+			))
+			return err
+		}
+		changes = append(changes, flowEventDomain.Change{FlowEvent: *fe, Balance: &balance})
+
+		err = svc.UpdateOwnership(ctx, fe)
+		if err != nil {
+			logger.Error("UpdateOwnership", zap.Error(
+				fmt.Errorf("nft: %v, height: %v, range %v - %v: %w", fe.NFTID, e.Height, batch.StartBlock, batch.EndBlock, err),
+			))
+			return err
+		}
+	}
+
+	err := svc.PairTransfers(ctx, created)
 	if err != nil {
-		logger.Error("GetEventsForHeightRange", zap.Error(fmt.Errorf("range %v - %v: %s", startBlock, endBlock, err)))
-		return
+		logger.Error("PairTransfers", zap.Error(fmt.Errorf("range %v - %v: %w", batch.StartBlock, batch.EndBlock, err)))
+		return err
 	}
 
-	for _, be := range bes {
-		logger.Debug("BlockEvent", zap.Uint64("BlockHeight", be.Height))
-		for _, e := range be.Events {
-			if e.Type != eventType {
-				continue
-			}
-			logger.Debug("Event", zap.String("Type", e.Type))
-			logger.Debug("Event", zap.String("TransactionID", e.TransactionID.String()))
-			logger.Debug("Event", zap.String("TransactionIndex", fmt.Sprintf("%d", e.TransactionIndex)))
-			logger.Debug("Event", zap.String("EventIndex", fmt.Sprintf("%d", e.EventIndex)))
-
-			// NOTE: the struct of deposit and withdraw events are the same
-			// so we can use the same function to parse them
-			flowEvent := FreeflowDeposit(e)
-			logger.Debug("Event", zap.Uint64("ID", flowEvent.ID()))
-			logger.Debug("Event", zap.String("Address", fmt.Sprintf("%x", flowEvent.Address())))
-
-			err := svc.CreateFlowEvent(context.Background(), flowEvent.ID(), fmt.Sprintf("%x", flowEvent.Address()), e.Type, be.Height)
-			if err != nil {
-				logger.Error("CreateFlowEvent", zap.Error(err))
-				return
-			}
+	err = svc.PublishChanges(ctx, changes)
+	if err != nil {
+		logger.Error("PublishChanges", zap.Error(fmt.Errorf("range %v - %v: %w", batch.StartBlock, batch.EndBlock, err)))
+		return err
+	}
 
-			err = svc.UpdateBalance(context.Background(), "freeflow", fmt.Sprintf("%x", flowEvent.Address()), eventType == FreeflowDepositEventType)
-			if err != nil {
-				logger.Error("UpdateBalance", zap.Error(
-					fmt.Errorf(
-						"address: %x, height: %v, range %v - %v: %e", flowEvent.Address(), be.Height, startBlock, endBlock, err,
-					),
-				))
-				return
+	return nil
+}
+
+// FollowEvents keeps indexing new blocks from startBlock onward until ctx is
+// done, then returns ctx.Err() once the batch being committed is stored.
+// Blocks are only scanned once they are finalityLag blocks behind the latest
+// sealed block, and the chain head is polled every pollInterval. Following
+// resumes after the scanned heights startBlock falls in, and progress is
+// stored as the checkpoint of the open-ended range [startBlock, 0].
+func FollowEvents(
+	ctx context.Context,
+	startBlock, maxBlockQuery, finalityLag uint64,
+	pollInterval time.Duration,
+	flowClient *client.Client,
+	logger *zap.Logger,
+	svc service.Service,
+	eventTypes []string,
+) error {
+	key := CheckpointKey(eventTypes)
+	scanned, err := svc.ScannedIntervals(ctx, key)
+	if err != nil {
+		return fmt.Errorf("ScannedIntervals: %w", err)
+	}
+
+	next := startBlock
+	if missing := checkpoint.Missing(scanned, startBlock, math.MaxUint64); len(missing) > 0 {
+		next = missing[0].Start
+	}
+	logger.Info("start follow", zap.Uint64("from", next), zap.Uint64("finalityLag", finalityLag))
+
+	for {
+		header, err := flowClient.GetLatestBlockHeader(ctx, true)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.Error("GetLatestBlockHeader", zap.Error(err))
+		} else if header.Height >= next+finalityLag {
+			target := header.Height - finalityLag
+			for next <= target && ctx.Err() == nil {
+				end := next + maxBlockQuery - 1
+				if end > target {
+					end = target
+				}
+
+				err = ScanBatchEvents(ctx, next, end, BlockRange{StartBlock: startBlock}, flowClient, logger, svc, eventTypes)
+				if ctx.Err() != nil {
+					break
+				}
+				if err != nil {
+					logger.Error("follow", zap.Error(fmt.Errorf("range %v - %v: %w", next, end, err)))
+					break
+				}
+				logger.Debug("follow", zap.Uint64("height", end), zap.Uint64("head", header.Height))
+				next = end + 1
 			}
 		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
 	}
 }
 
 func getBlockTxs(
+	ctx context.Context,
 	blockNum uint64,
 	flowClient *client.Client,
 	logger *zap.Logger,
 	svc service.Service,
 ) {
-	ctx := context.Background()
 	logger.Debug("Block", zap.Uint64("BlockHeight", blockNum))
 	block, err := flowClient.GetBlockByHeight(ctx, blockNum)
 	if err != nil {
@@ -157,7 +383,17 @@ func getBlockTxs(
 				}
 				logger.Debug("Event", zap.String("Address", fmt.Sprintf("%x", flowEvent.Address())))
 
-				err := svc.UpdateBalance(ctx, "freeflow", fmt.Sprintf("%x", flowEvent.Address()), e.Type == FreeflowDepositEventType)
+				fe := &flowEventDomain.FlowEvent{
+					Account:          fmt.Sprintf("%x", flowEvent.Address()),
+					Inscription:      FreeflowInscription,
+					NFTID:            flowEvent.ID(),
+					Event:            e.Type,
+					Block:            blockNum,
+					TransactionID:    e.TransactionID.String(),
+					TransactionIndex: e.TransactionIndex,
+					EventIndex:       e.EventIndex,
+				}
+				_, err := svc.UpdateBalance(ctx, fe)
 				if err != nil {
 					logger.Error("UpdateBalance", zap.Error(err))
 					return